@@ -0,0 +1,313 @@
+package catalog
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/metrics"
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+	"github.com/tinyzimmer/bg3mods-feed/internal/store"
+	"github.com/tinyzimmer/bg3mods-feed/internal/tracing"
+)
+
+// tracer returns the catalog tracer of the current global tracer provider.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/tinyzimmer/bg3mods-feed/internal/catalog")
+}
+
+// snapshotKey is the key the catalog is recorded under in the store.
+const snapshotKey = "catalog"
+
+// pageSize is the number of mods fetched per request when syncing.
+const pageSize = 100
+
+// Catalog is an interface for a local copy of every mod available from the API.
+type Catalog interface {
+	// Load restores the catalog from the last copy recorded in the store.
+	Load(context.Context) error
+	// Sync fetches the mods updated since the last sync from the API and
+	// merges them into the catalog. Every full sync interval, every mod is
+	// fetched instead and replaces the catalog. Concurrent calls share a
+	// single sync.
+	Sync(context.Context) error
+	// Select returns the mods in the catalog that match the given function,
+	// along with the time the catalog was last synced.
+	Select(match func(mods.Mod) bool) ([]mods.Mod, time.Time)
+	// Lookup returns the mod with the given name ID.
+	Lookup(nameID string) (mods.Mod, bool)
+	// SyncedAt returns the time the catalog was last synced. It is zero if
+	// the catalog has never been synced or loaded.
+	SyncedAt() time.Time
+	// Status returns the state of the catalog.
+	Status() Status
+}
+
+// Status is the state of a catalog.
+type Status struct {
+	// Mods is the number of mods in the catalog.
+	Mods int `json:"mods"`
+	// SyncedAt is the time the catalog was last synced.
+	SyncedAt time.Time `json:"synced_at"`
+	// FullSyncedAt is the time every mod in the catalog was last synced.
+	FullSyncedAt time.Time `json:"full_synced_at"`
+	// LastError is the error the last failed sync failed with, if any.
+	LastError string `json:"last_error,omitempty"`
+	// LastErrorAt is the time of the last failed sync, if any.
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type catalog struct {
+	api              mods.Fetcher
+	store            store.Store
+	fullSyncInterval time.Duration
+
+	// mods are ordered by ID.
+	mods         []mods.Mod
+	byNameID     map[string]int
+	syncedAt     time.Time
+	fullSyncedAt time.Time
+	// cursor is the newest date_updated of any mod in the catalog.
+	cursor uint64
+	// lastErr is the error the last failed sync failed with, at lastErrAt.
+	lastErr   error
+	lastErrAt time.Time
+	mu        sync.RWMutex
+
+	inflight singleflight.Group
+}
+
+// New creates a new Catalog that syncs mods using the given fetcher and
+// records them in the given store. Between syncs of every mod, which
+// happen every fullSyncInterval, only mods updated since the last sync are
+// fetched.
+func New(fetcher mods.Fetcher, store store.Store, fullSyncInterval time.Duration) Catalog {
+	return &catalog{
+		api:              fetcher,
+		store:            store,
+		fullSyncInterval: fullSyncInterval,
+		byNameID:         make(map[string]int),
+	}
+}
+
+func (c *catalog) Load(ctx context.Context) error {
+	snapshot, err := c.store.GetSnapshot(ctx, snapshotKey)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to load catalog snapshot: %w", err)
+	}
+	records, err := c.store.GetMods(ctx, snapshot.ModIDs)
+	if err != nil {
+		return fmt.Errorf("failed to load catalog mods: %w", err)
+	}
+	modList := make([]mods.Mod, len(records))
+	for i, record := range records {
+		modList[i] = record.Mod
+	}
+	c.mu.Lock()
+	c.replace(modList)
+	c.syncedAt = snapshot.SyncedAt
+	c.fullSyncedAt = snapshot.FullSyncedAt
+	c.mu.Unlock()
+	metrics.CatalogMods.Set(float64(len(modList)))
+	metrics.CatalogLastSync.Set(float64(snapshot.SyncedAt.Unix()))
+	slog.InfoContext(ctx, "Loaded catalog", "mods", len(modList), "synced_at", snapshot.SyncedAt)
+	return nil
+}
+
+func (c *catalog) Sync(ctx context.Context) error {
+	ch := c.inflight.DoChan(snapshotKey, func() (any, error) {
+		return nil, c.sync(context.WithoutCancel(ctx))
+	})
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res := <-ch:
+		return res.Err
+	}
+}
+
+func (c *catalog) sync(ctx context.Context) error {
+	start := time.Now().UTC()
+	c.mu.RLock()
+	full := c.cursor == 0 || start.Sub(c.fullSyncedAt) >= c.fullSyncInterval
+	var updatedSince time.Time
+	if !full {
+		updatedSince = time.Unix(int64(c.cursor), 0)
+	}
+	c.mu.RUnlock()
+	syncType := "incremental"
+	if full {
+		syncType = "full"
+	}
+	ctx, span := tracer().Start(ctx, "catalog.Sync", trace.WithAttributes(
+		attribute.String("catalog.sync_type", syncType),
+	))
+	defer span.End()
+
+	var modList []mods.Mod
+	var pages int
+	for offset := 0; ; offset += pageSize {
+		res, err := c.api.Fetch(ctx, mods.FetchOptions{
+			Limit:          pageSize,
+			Offset:         offset,
+			Sort:           "id",
+			DateUpdatedMin: updatedSince,
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to fetch mods: %w", err)
+			metrics.CatalogSyncs.WithLabelValues(syncType, "failure").Inc()
+			c.mu.Lock()
+			c.lastErr, c.lastErrAt = err, time.Now().UTC()
+			c.mu.Unlock()
+			return tracing.RecordError(span, err)
+		}
+		pages++
+		if err := c.store.PutMods(ctx, res.Data, time.Now().UTC()); err != nil {
+			slog.WarnContext(ctx, "Failed to record fetched mods", "error", err)
+		}
+		modList = append(modList, res.Data...)
+		if len(res.Data) < pageSize {
+			break
+		}
+	}
+
+	c.mu.Lock()
+	if full {
+		c.replace(modList)
+		c.fullSyncedAt = start
+	} else {
+		c.merge(modList)
+	}
+	c.syncedAt = start
+	size := len(c.mods)
+	c.mu.Unlock()
+	c.snapshot(ctx)
+	metrics.CatalogSyncs.WithLabelValues(syncType, "success").Inc()
+	metrics.CatalogSyncPages.WithLabelValues(syncType).Observe(float64(pages))
+	metrics.CatalogLastSync.Set(float64(start.Unix()))
+	metrics.CatalogMods.Set(float64(size))
+	span.SetAttributes(
+		attribute.Int("catalog.pages", pages),
+		attribute.Int("catalog.mods", size),
+	)
+	attrs := []any{"type", syncType, "mods", len(modList), "pages", pages, "duration", time.Since(start)}
+	if !full {
+		attrs = append(attrs, "updated_since", updatedSince.UTC())
+	}
+	slog.InfoContext(ctx, "Synced catalog", attrs...)
+	return nil
+}
+
+// replace swaps the contents of the catalog for the given mods. The caller
+// must hold the write lock.
+func (c *catalog) replace(modList []mods.Mod) {
+	slices.SortFunc(modList, func(a, b mods.Mod) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	c.mods = modList
+	c.byNameID = make(map[string]int, len(modList))
+	c.cursor = 0
+	for i, mod := range modList {
+		c.byNameID[mod.NameID] = i
+		c.cursor = max(c.cursor, mod.DateUpdatedEpoch)
+	}
+}
+
+// merge adds the given mods to the catalog, replacing any with the same ID.
+// The caller must hold the write lock.
+func (c *catalog) merge(updated []mods.Mod) {
+	if len(updated) == 0 {
+		return
+	}
+	byID := make(map[int]mods.Mod, len(updated))
+	for _, mod := range updated {
+		byID[mod.ID] = mod
+	}
+	modList := make([]mods.Mod, 0, len(c.mods)+len(updated))
+	for _, mod := range c.mods {
+		if newer, ok := byID[mod.ID]; ok {
+			mod = newer
+			delete(byID, mod.ID)
+		}
+		modList = append(modList, mod)
+	}
+	for _, mod := range byID {
+		modList = append(modList, mod)
+	}
+	c.replace(modList)
+}
+
+// snapshot records the mods in the catalog so it can be loaded later.
+func (c *catalog) snapshot(ctx context.Context) {
+	c.mu.RLock()
+	ids := make([]int, len(c.mods))
+	for i, mod := range c.mods {
+		ids[i] = mod.ID
+	}
+	snapshot := &store.Snapshot{
+		ModIDs:       ids,
+		SyncedAt:     c.syncedAt,
+		FullSyncedAt: c.fullSyncedAt,
+	}
+	c.mu.RUnlock()
+	if err := c.store.PutSnapshot(ctx, snapshotKey, snapshot); err != nil {
+		slog.WarnContext(ctx, "Failed to save catalog snapshot", "error", err)
+	}
+}
+
+func (c *catalog) Select(match func(mods.Mod) bool) ([]mods.Mod, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var selected []mods.Mod
+	for _, mod := range c.mods {
+		if match(mod) {
+			selected = append(selected, mod)
+		}
+	}
+	return selected, c.syncedAt
+}
+
+func (c *catalog) Lookup(nameID string) (mods.Mod, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i, ok := c.byNameID[nameID]
+	if !ok {
+		return mods.Mod{}, false
+	}
+	return c.mods[i], true
+}
+
+func (c *catalog) SyncedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.syncedAt
+}
+
+func (c *catalog) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	status := Status{
+		Mods:         len(c.mods),
+		SyncedAt:     c.syncedAt,
+		FullSyncedAt: c.fullSyncedAt,
+	}
+	if c.lastErr != nil {
+		lastErrAt := c.lastErrAt
+		status.LastError = c.lastErr.Error()
+		status.LastErrorAt = &lastErrAt
+	}
+	return status
+}
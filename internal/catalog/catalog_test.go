@@ -0,0 +1,207 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+	"github.com/tinyzimmer/bg3mods-feed/internal/store"
+)
+
+// fakeFetcher serves pages of mods sorted by ID, and records the options of
+// every fetch.
+type fakeFetcher struct {
+	mu    sync.Mutex
+	mods  []mods.Mod
+	calls []mods.FetchOptions
+	// failAt is the offset of a page that fails to be fetched, if set.
+	failAt int
+}
+
+func (f *fakeFetcher) Fetch(_ context.Context, opts mods.FetchOptions) (*mods.GetModsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, opts)
+	if f.failAt > 0 && opts.Offset == f.failAt {
+		return nil, errors.New("service unavailable")
+	}
+	var matched []mods.Mod
+	for _, mod := range f.mods {
+		if opts.DateUpdatedMin.IsZero() || mod.DateUpdatedEpoch >= uint64(opts.DateUpdatedMin.Unix()) {
+			matched = append(matched, mod)
+		}
+	}
+	page := matched[min(opts.Offset, len(matched)):min(opts.Offset+opts.Limit, len(matched))]
+	return &mods.GetModsResponse{Data: page, ResultCount: len(page), ResultTotal: len(matched)}, nil
+}
+
+func (f *fakeFetcher) FetchModfiles(context.Context, int, mods.FetchOptions) (*mods.GetModfilesResponse, error) {
+	return nil, errors.New("unexpected fetch")
+}
+
+// set replaces the mods served, and forgets earlier fetches.
+func (f *fakeFetcher) set(modList []mods.Mod) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mods, f.calls = modList, nil
+}
+
+func (f *fakeFetcher) fetches() []mods.FetchOptions {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+var epoch = time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+
+func testMod(id int, updated time.Time) mods.Mod {
+	return mods.Mod{
+		ID:               id,
+		NameID:           fmt.Sprintf("mod-%d", id),
+		Name:             fmt.Sprintf("Mod %d", id),
+		DateUpdatedEpoch: uint64(updated.Unix()),
+	}
+}
+
+// testMods returns n mods, the last of which was updated most recently.
+func testMods(n int) []mods.Mod {
+	modList := make([]mods.Mod, n)
+	for i := range modList {
+		modList[i] = testMod(i+1, epoch.Add(time.Duration(i)*time.Minute))
+	}
+	return modList
+}
+
+func newTestCatalog(fetcher *fakeFetcher) *catalog {
+	return New(fetcher, store.NewMemoryStore(), time.Hour).(*catalog)
+}
+
+func TestSyncFullThenIncremental(t *testing.T) {
+	fetcher := &fakeFetcher{mods: testMods(150)}
+	c := newTestCatalog(fetcher)
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	calls := fetcher.fetches()
+	if len(calls) != 2 {
+		t.Fatalf("first sync fetched %d pages, want 2", len(calls))
+	}
+	for _, call := range calls {
+		if !call.DateUpdatedMin.IsZero() {
+			t.Errorf("first sync fetched mods updated since %v, want every mod", call.DateUpdatedMin)
+		}
+	}
+	status := c.Status()
+	if status.Mods != 150 {
+		t.Errorf("catalog has %d mods, want 150", status.Mods)
+	}
+	if status.FullSyncedAt.IsZero() {
+		t.Error("first sync was not recorded as a full sync")
+	}
+	cursor := epoch.Add(149 * time.Minute)
+
+	updated := testMods(150)
+	updated[4] = testMod(5, cursor.Add(time.Minute))
+	updated[4].Name = "Mod 5 v2"
+	updated = append(updated, testMod(200, cursor.Add(2*time.Minute)))
+	fetcher.set(updated)
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	calls = fetcher.fetches()
+	if len(calls) != 1 {
+		t.Fatalf("incremental sync fetched %d pages, want 1", len(calls))
+	}
+	if !calls[0].DateUpdatedMin.Equal(cursor) {
+		t.Errorf("incremental sync fetched mods updated since %v, want %v", calls[0].DateUpdatedMin, cursor)
+	}
+	if got := c.Status(); got.Mods != 151 || !got.FullSyncedAt.Equal(status.FullSyncedAt) {
+		t.Errorf("after incremental sync: %d mods, full sync at %v; want 151 mods, full sync at %v", got.Mods, got.FullSyncedAt, status.FullSyncedAt)
+	}
+	if mod, ok := c.Lookup("mod-5"); !ok || mod.Name != "Mod 5 v2" {
+		t.Errorf("Lookup(mod-5) = %q, %v; want the updated mod", mod.Name, ok)
+	}
+	if _, ok := c.Lookup("mod-200"); !ok {
+		t.Error("Lookup(mod-200) did not find the new mod")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	c := newTestCatalog(&fakeFetcher{})
+	c.replace([]mods.Mod{testMod(3, epoch), testMod(1, epoch), testMod(2, epoch)})
+	newer := testMod(2, epoch.Add(time.Hour))
+	newer.Name = "Mod 2 v2"
+	c.merge([]mods.Mod{testMod(4, epoch.Add(time.Minute)), newer})
+
+	var ids []int
+	for _, mod := range c.mods {
+		ids = append(ids, mod.ID)
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4]" {
+		t.Errorf("catalog has mods %v, want [1 2 3 4]", ids)
+	}
+	if mod, _ := c.Lookup("mod-2"); mod.Name != "Mod 2 v2" {
+		t.Errorf("Lookup(mod-2) = %q, want the merged mod", mod.Name)
+	}
+	if want := uint64(epoch.Add(time.Hour).Unix()); c.cursor != want {
+		t.Errorf("cursor = %d, want %d", c.cursor, want)
+	}
+}
+
+func TestSyncFullAfterInterval(t *testing.T) {
+	fetcher := &fakeFetcher{mods: testMods(10)}
+	c := newTestCatalog(fetcher)
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	c.mu.Lock()
+	c.fullSyncedAt = c.fullSyncedAt.Add(-time.Hour)
+	c.mu.Unlock()
+
+	// Mods removed from the API are only dropped by full syncs
+	fetcher.set(testMods(8))
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	calls := fetcher.fetches()
+	if len(calls) != 1 || !calls[0].DateUpdatedMin.IsZero() {
+		t.Errorf("sync after the full sync interval fetched %+v, want every mod", calls)
+	}
+	if status := c.Status(); status.Mods != 8 {
+		t.Errorf("catalog has %d mods, want 8", status.Mods)
+	}
+}
+
+func TestSyncFailedPage(t *testing.T) {
+	fetcher := &fakeFetcher{mods: testMods(150)}
+	c := newTestCatalog(fetcher)
+	if err := c.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	before := c.Status()
+
+	c.mu.Lock()
+	c.fullSyncedAt = c.fullSyncedAt.Add(-time.Hour)
+	c.mu.Unlock()
+	updated := testMods(250)
+	updated[0].Name = "Mod 1 v2"
+	fetcher.set(updated)
+	fetcher.failAt = 100
+	if err := c.Sync(context.Background()); err == nil {
+		t.Fatal("Sync() error = nil, want the failed page")
+	}
+	after := c.Status()
+	if after.Mods != before.Mods || !after.SyncedAt.Equal(before.SyncedAt) {
+		t.Errorf("after failed sync: %d mods synced at %v; want %d mods synced at %v", after.Mods, after.SyncedAt, before.Mods, before.SyncedAt)
+	}
+	if mod, _ := c.Lookup("mod-1"); mod.Name != "Mod 1" {
+		t.Errorf("Lookup(mod-1) = %q, want the mod from before the failed sync", mod.Name)
+	}
+	if after.LastError == "" || after.LastErrorAt == nil {
+		t.Errorf("Status() = %+v, want the last error", after)
+	}
+}
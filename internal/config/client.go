@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	DefaultHTTPTimeout       = 30 * time.Second
+	DefaultMaxRetries        = 3
+	DefaultRetryBackoff      = time.Second
+	DefaultMaxRetryBackoff   = 30 * time.Second
+	DefaultRequestsPerMinute = 60
+	DefaultRequestBurst      = 10
+	DefaultPageCacheSize     = 200
+	// DefaultPageCacheMaxSize holds about 200 pages of 100 mods, which are
+	// around 300KB each.
+	DefaultPageCacheMaxSize ByteSize = 64 << 20
+)
+
+// ClientConfig are the options for the client used to fetch mods from the API.
+type ClientConfig struct {
+	// APIKey is a mod.io API key to authenticate with. It is required by the
+	// official mod.io API, but not by the default API.
+	APIKey string `mapstructure:"api-key"`
+	// AccessToken is a mod.io OAuth access token to authenticate with,
+	// instead of or as well as an API key.
+	AccessToken string `mapstructure:"access-token"`
+	// HTTPTimeout is the timeout for a single request to the API. Defaults
+	// to 30 seconds.
+	HTTPTimeout time.Duration `mapstructure:"http-timeout"`
+	// MaxRetries is the number of times failed requests are retried. Defaults to 3.
+	MaxRetries int `mapstructure:"max-retries"`
+	// RetryBackoff is the wait before the first retry of a request. It doubles
+	// after every retry. Defaults to 1 second.
+	RetryBackoff time.Duration `mapstructure:"retry-backoff"`
+	// MaxRetryBackoff is the longest wait between retries of a request.
+	// Defaults to 30 seconds.
+	MaxRetryBackoff time.Duration `mapstructure:"max-retry-backoff"`
+	// RequestsPerMinute is the number of requests per minute the API is sent
+	// at most, across all feeds. Zero means no limit. Defaults to 60.
+	RequestsPerMinute float64 `mapstructure:"requests-per-minute"`
+	// RequestBurst is the number of requests that can be sent at once before
+	// being limited to RequestsPerMinute. Defaults to 10.
+	RequestBurst int `mapstructure:"request-burst"`
+	// PageCacheSize is the number of responses from the API kept to be
+	// revalidated with conditional requests, so unchanged pages are not
+	// downloaded again. Zero disables it. Defaults to 200.
+	PageCacheSize int `mapstructure:"page-cache-size"`
+	// PageCacheMaxSize is the most memory the responses kept for
+	// PageCacheSize can take up. Zero means no limit. Defaults to 64MiB.
+	PageCacheMaxSize ByteSize `mapstructure:"page-cache-max-size"`
+}
+
+func (c ClientConfig) validate() error {
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("invalid max retries: %d", c.MaxRetries)
+	}
+	if c.RequestBurst < 1 {
+		return fmt.Errorf("invalid request burst: %d", c.RequestBurst)
+	}
+	return nil
+}
+
+// LogValue logs the options of the client as a group, with secrets redacted.
+func (c ClientConfig) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("api_key", redact(c.APIKey)),
+		slog.String("access_token", redact(c.AccessToken)),
+		slog.Duration("http_timeout", c.HTTPTimeout),
+		slog.Int("max_retries", c.MaxRetries),
+		slog.Duration("retry_backoff", c.RetryBackoff),
+		slog.Duration("max_retry_backoff", c.MaxRetryBackoff),
+		slog.Float64("requests_per_minute", c.RequestsPerMinute),
+		slog.Int("request_burst", c.RequestBurst),
+		slog.Int("page_cache_size", c.PageCacheSize),
+		slog.String("page_cache_max_size", c.PageCacheMaxSize.String()),
+	)
+}
+
+// redact hides a secret in logs, showing only whether it is set.
+func redact(secret string) string {
+	if secret == "" {
+		return "<not set>"
+	}
+	return "<redacted>"
+}
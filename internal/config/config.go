@@ -2,22 +2,31 @@ package config
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 const (
-	DefaultAPIURL        = "https://embed.modhub.io/v1/games/6715/mods"
-	DefaultListen        = ":8080"
-	DefaultSort          = "recent"
-	DefaultMaxItems      = 100
-	DefaultFetchInterval = 5 * time.Minute
-	DefaultFormat        = FormatAtom
+	DefaultAPIURL           = "https://embed.modhub.io/v1/games/6715/mods"
+	DefaultListen           = ":8080"
+	DefaultSort             = "recent"
+	DefaultUpdatesSort      = "last_updated"
+	DefaultMaxItems         = 100
+	DefaultFetchInterval    = 5 * time.Minute
+	DefaultFullSyncInterval = time.Hour
+	DefaultFormat           = FormatAtom
+	DefaultMode             = ModeMods
+	DefaultTagsMatch        = MatchAny
+	DefaultPlatformMatch    = MatchAny
+	DefaultLogLevel         = slog.LevelInfo
+	DefaultLogFormat        = LogFormatText
 )
 
 type Platform string
@@ -29,6 +38,9 @@ const (
 	PlatformXBoxSeriesX Platform = "xboxseriesx"
 )
 
+// Platforms are all the valid platforms.
+var Platforms = []Platform{PlatformWindows, PlatformMac, PlatformPS5, PlatformXBoxSeriesX}
+
 func (p Platform) IsValid() bool {
 	switch p {
 	case PlatformWindows, PlatformMac, PlatformPS5, PlatformXBoxSeriesX:
@@ -37,6 +49,49 @@ func (p Platform) IsValid() bool {
 	return false
 }
 
+// ParsePlatforms parses a list of platform names, returning an error
+// for any that are not valid.
+func ParsePlatforms(names []string) ([]Platform, error) {
+	var platforms []Platform
+	for _, name := range names {
+		platform := Platform(strings.ToLower(strings.TrimSpace(name)))
+		if platform == "" {
+			continue
+		}
+		if !platform.IsValid() {
+			return nil, fmt.Errorf("invalid platform %q (valid platforms: %s)", name, JoinPlatforms(Platforms))
+		}
+		platforms = append(platforms, platform)
+	}
+	return platforms, nil
+}
+
+// JoinPlatforms joins the given platforms into a comma separated string.
+func JoinPlatforms(platforms []Platform) string {
+	names := make([]string, len(platforms))
+	for i, p := range platforms {
+		names[i] = string(p)
+	}
+	return strings.Join(names, ", ")
+}
+
+type MatchMode string
+
+const (
+	// MatchAny matches when any of the given values match.
+	MatchAny MatchMode = "any"
+	// MatchAll matches only when all of the given values match.
+	MatchAll MatchMode = "all"
+)
+
+func (m MatchMode) IsValid() bool {
+	switch m {
+	case MatchAny, MatchAll:
+		return true
+	}
+	return false
+}
+
 type FeedFormat string
 
 const (
@@ -53,37 +108,95 @@ func (f FeedFormat) IsValid() bool {
 	return false
 }
 
+type FeedMode string
+
+const (
+	// ModeMods renders one feed item per mod.
+	ModeMods FeedMode = "mods"
+	// ModeUpdates renders one feed item per release (modfile) of a mod.
+	ModeUpdates FeedMode = "updates"
+)
+
+func (m FeedMode) IsValid() bool {
+	switch m {
+	case ModeMods, ModeUpdates:
+		return true
+	}
+	return false
+}
+
+type LogFormat string
+
+const (
+	LogFormatText LogFormat = "text"
+	LogFormatJSON LogFormat = "json"
+)
+
+func (f LogFormat) IsValid() bool {
+	switch f {
+	case LogFormatText, LogFormatJSON:
+		return true
+	}
+	return false
+}
+
 type Configuration struct {
 	// Listen is the address to listen on. Defaults to :8080.
 	Listen string `mapstructure:"listen"`
 	// The API URL to fetch mods from. Defaults to the modhub.io API.
 	APIURL string `mapstructure:"api-url"`
-	// Tags to filter mods by
-	Tags []string `mapstructure:"tags"`
-	// Platforms to filter mods by
-	Platform Platform `mapstructure:"platform"`
-	// MaxFeedItems is the maximum number of feed items to render.
-	// Defaults to 100 items.
-	MaxFeedItems int `mapstructure:"max-feed-items"`
-	// The field to sort the feed by. Defaults to -date_added.
-	Sort string `mapstructure:"sort"`
+	// StorePath is the path to the file fetched mods are persisted to.
+	// If empty, mods are only kept in memory.
+	StorePath string `mapstructure:"store-path"`
 	// FetchInterval is the interval to fetch mods at. Defaults to 5 minutes.
 	FetchInterval time.Duration `mapstructure:"fetch-interval"`
-	// Format is the format to render the feed in. Valid options are
-	// "rss", "atom", and "json". Defaults to "atom".
-	Format FeedFormat `mapstructure:"format"`
+	// FullSyncInterval is the interval to fetch every mod at. In between, only
+	// mods updated since the last fetch are fetched. Defaults to 1 hour.
+	FullSyncInterval time.Duration `mapstructure:"full-sync-interval"`
+	// MaxSyncAge is the longest time since mods were last fetched for the
+	// server to be reported ready. Defaults to 3 fetch intervals.
+	MaxSyncAge time.Duration `mapstructure:"max-sync-age"`
+	// LogLevel is the minimum level of messages to log. Valid options are
+	// "debug", "info", "warn" and "error". Defaults to "info".
+	LogLevel slog.Level `mapstructure:"log-level"`
+	// LogFormat is the format to log in. Valid options are "text" and "json".
+	// Defaults to "text".
+	LogFormat LogFormat `mapstructure:"log-format"`
+	// OTLPEndpoint is the URL of an OTLP/HTTP collector to export traces to,
+	// e.g. http://localhost:4318. If empty, traces are not exported.
+	OTLPEndpoint string `mapstructure:"otlp-endpoint"`
+	// ClientConfig are the options for the client used to fetch mods.
+	ClientConfig `mapstructure:",squash"`
+	// FeedConfig are the options for the default feed served at /feed.
+	// They are also the defaults for named feeds.
+	FeedConfig `mapstructure:",squash"`
+	// Feeds are additional named feeds served at /feeds/{name}.
+	Feeds []NamedFeed `mapstructure:"feeds"`
 }
 
+// Log logs the configuration, followed by each named feed.
 func (c Configuration) Log() {
-	log.Println("Configuration:")
-	log.Println("    Listen:", c.Listen)
-	log.Println("    API URL:", c.APIURL)
-	log.Println("    Tags:", strings.Join(c.Tags, ", "))
-	log.Println("    Platform:", c.Platform)
-	log.Println("    Max Feed Items:", c.MaxFeedItems)
-	log.Println("    Sort:", c.Sort)
-	log.Println("    Fetch Interval:", c.FetchInterval)
-	log.Println("    Format:", c.Format)
+	slog.Info("Configuration",
+		slog.String("listen", c.Listen),
+		slog.String("api_url", c.APIURL),
+		slog.String("store_path", c.StorePath),
+		slog.Duration("fetch_interval", c.FetchInterval),
+		slog.Duration("full_sync_interval", c.FullSyncInterval),
+		slog.Duration("max_sync_age", c.MaxSyncAge),
+		slog.String("log_level", c.LogLevel.String()),
+		slog.String("log_format", string(c.LogFormat)),
+		slog.String("otlp_endpoint", c.OTLPEndpoint),
+		slog.Any("client", c.ClientConfig),
+		slog.Any("feed", c.FeedConfig),
+	)
+	for _, feed := range c.Feeds {
+		slog.Info("Named feed",
+			slog.String("name", feed.Name),
+			slog.String("title", feed.Title),
+			slog.String("description", feed.Description),
+			slog.Any("feed", feed.FeedConfig),
+		)
+	}
 }
 
 var viperOnce sync.Once
@@ -98,15 +211,61 @@ func Load(filename string) (Configuration, error) {
 			return c, err
 		}
 	}
-	if err := v.Unmarshal(&c); err != nil {
+	hooks := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		timeBoundHookFunc(),
+		mapstructure.TextUnmarshallerHookFunc(),
+	))
+	if err := v.Unmarshal(&c, hooks); err != nil {
+		return c, err
+	}
+	if c.MaxSyncAge == 0 {
+		c.MaxSyncAge = 3 * c.FetchInterval
+	}
+	if !c.LogFormat.IsValid() {
+		return c, fmt.Errorf("invalid log format: %s", c.LogFormat)
+	}
+	if err := c.ClientConfig.validate(); err != nil {
 		return c, err
 	}
-	if !c.Format.IsValid() {
-		return c, fmt.Errorf("invalid feed format: %s", c.Format)
+	if err := c.FeedConfig.validate(true); err != nil {
+		return c, err
+	}
+	names := make(map[string]struct{}, len(c.Feeds))
+	for _, feed := range c.Feeds {
+		if feed.Name == "" {
+			return c, fmt.Errorf("feeds must have a name")
+		}
+		if _, ok := names[feed.Name]; ok {
+			return c, fmt.Errorf("duplicate feed name: %s", feed.Name)
+		}
+		names[feed.Name] = struct{}{}
+		if err := feed.FeedConfig.validate(false); err != nil {
+			return c, fmt.Errorf("feed %s: %w", feed.Name, err)
+		}
 	}
 	return c, nil
 }
 
+// timeBoundHookFunc decodes dates that YAML and TOML files hold as times rather
+// than strings into time bounds. Strings are left for TextUnmarshallerHookFunc,
+// and anything else is rejected rather than decoded into a zero bound.
+func timeBoundHookFunc() mapstructure.DecodeHookFuncType {
+	return func(from, to reflect.Type, data any) (any, error) {
+		if to != reflect.TypeOf(TimeBound{}) {
+			return data, nil
+		}
+		switch v := data.(type) {
+		case nil, string, TimeBound:
+			return data, nil
+		case time.Time:
+			return TimeBound{At: v.UTC()}, nil
+		}
+		return nil, fmt.Errorf("invalid time: %v", data)
+	}
+}
+
 func GetViper() *viper.Viper {
 	viperOnce.Do(func() {
 		v := viper.New()
@@ -116,9 +275,22 @@ func GetViper() *viper.Viper {
 		v.SetDefault("listen", DefaultListen)
 		v.SetDefault("api-url", DefaultAPIURL)
 		v.SetDefault("max-feed-items", DefaultMaxItems)
-		v.SetDefault("sort", DefaultSort)
 		v.SetDefault("fetch-interval", DefaultFetchInterval)
+		v.SetDefault("full-sync-interval", DefaultFullSyncInterval)
+		v.SetDefault("http-timeout", DefaultHTTPTimeout)
+		v.SetDefault("max-retries", DefaultMaxRetries)
+		v.SetDefault("retry-backoff", DefaultRetryBackoff)
+		v.SetDefault("max-retry-backoff", DefaultMaxRetryBackoff)
+		v.SetDefault("requests-per-minute", DefaultRequestsPerMinute)
+		v.SetDefault("request-burst", DefaultRequestBurst)
+		v.SetDefault("page-cache-size", DefaultPageCacheSize)
+		v.SetDefault("page-cache-max-size", DefaultPageCacheMaxSize.String())
+		v.SetDefault("log-level", strings.ToLower(DefaultLogLevel.String()))
+		v.SetDefault("log-format", string(DefaultLogFormat))
 		v.SetDefault("format", string(DefaultFormat))
+		v.SetDefault("mode", string(DefaultMode))
+		v.SetDefault("tags-match", string(DefaultTagsMatch))
+		v.SetDefault("platform-match", string(DefaultPlatformMatch))
 		viperInstance = v
 	})
 	return viperInstance
@@ -127,12 +299,47 @@ func GetViper() *viper.Viper {
 func BindPFlags(flags *pflag.FlagSet) {
 	flags.String("listen", DefaultListen, "The address to listen on")
 	flags.String("api-url", DefaultAPIURL, "The API URL to fetch mods from")
+	flags.String("store-path", "", "Path to a file to persist fetched mods to (in-memory if empty)")
+	flags.String("api-key", "", "A mod.io API key to authenticate with (required by the official mod.io API)")
+	flags.String("access-token", "", "A mod.io OAuth access token to authenticate with")
+	flags.Duration("http-timeout", DefaultHTTPTimeout, "The timeout for a single request to the API (0 for none)")
+	flags.Int("max-retries", DefaultMaxRetries, "The number of times failed requests to the API are retried")
+	flags.Duration("retry-backoff", DefaultRetryBackoff, "The wait before the first retry of a failed request (doubles after every retry)")
+	flags.Duration("max-retry-backoff", DefaultMaxRetryBackoff, "The longest wait between retries of a failed request")
+	flags.Float64("requests-per-minute", DefaultRequestsPerMinute, "The maximum number of requests per minute sent to the API (0 for no limit)")
+	flags.Int("request-burst", DefaultRequestBurst, "The number of requests that can be sent to the API at once before being rate limited")
+	flags.Int("page-cache-size", DefaultPageCacheSize, "The number of API responses kept to revalidate with conditional requests (0 to disable)")
+	flags.String("page-cache-max-size", "64MiB", "The most memory the kept API responses can take up (0 for no limit)")
 	flags.StringSlice("tags", nil, "Tags to filter mods by")
-	flags.String("platform", "", "Platform to filter mods by (windows, mac, ps5, xboxseriesx)")
+	flags.String("tags-match", string(DefaultTagsMatch), "Whether mods must have any or all of the tags (any, all)")
+	flags.StringSlice("tags-not", nil, "Tags to exclude mods by")
+	flags.String("search", "", "Text to filter mods by (matches name, summary and description)")
+	flags.Int("min-downloads", 0, "The minimum number of total downloads of mods")
+	flags.Int("max-downloads", 0, "The maximum number of total downloads of mods")
+	flags.Int("min-subscribers", 0, "The minimum number of subscribers of mods")
+	flags.Int("max-subscribers", 0, "The maximum number of subscribers of mods")
+	flags.Float64("min-rating", 0, "The minimum weighted rating of mods (0-1)")
+	flags.Float64("max-rating", 0, "The maximum weighted rating of mods (0-1)")
+	flags.Float64("min-positive", 0, "The minimum percentage of positive ratings of mods (0-100)")
+	flags.Float64("max-positive", 0, "The maximum percentage of positive ratings of mods (0-100)")
+	flags.String("min-filesize", "", "The minimum file size of mods (e.g. 10KB, 50MB)")
+	flags.String("max-filesize", "", "The maximum file size of mods (e.g. 10KB, 50MB)")
+	flags.String("added-since", "", "Only include mods added since a time (e.g. 2024-08-01 or 7d)")
+	flags.String("added-before", "", "Only include mods added before a time (e.g. 2024-08-01 or 7d)")
+	flags.String("updated-since", "", "Only include mods updated since a time (e.g. 2024-08-01 or 7d)")
+	flags.String("updated-before", "", "Only include mods updated before a time (e.g. 2024-08-01 or 7d)")
+	flags.StringSlice("platform", nil, "Platforms to filter mods by (windows, mac, ps5, xboxseriesx)")
+	flags.String("platform-match", string(DefaultPlatformMatch), "Whether mods must support any or all of the platforms (any, all)")
 	flags.Int("max-feed-items", DefaultMaxItems, "The maximum number of feed items to render")
-	flags.String("sort", DefaultSort, "The field to sort the feed by")
+	flags.String("sort", "", "The field to sort the feed by (default recent, or last_updated in updates mode)")
 	flags.Duration("fetch-interval", DefaultFetchInterval, "The interval to fetch mods at")
+	flags.Duration("full-sync-interval", DefaultFullSyncInterval, "The interval to fetch every mod at instead of only updated ones")
+	flags.Duration("max-sync-age", 0, "The longest time since mods were last fetched for the server to be ready (default 3 fetch intervals)")
+	flags.String("log-level", strings.ToLower(DefaultLogLevel.String()), "The minimum level of messages to log (debug, info, warn, error)")
+	flags.String("log-format", string(DefaultLogFormat), "The format to log in (text, json)")
+	flags.String("otlp-endpoint", "", "The URL of an OTLP/HTTP collector to export traces to (e.g. http://localhost:4318)")
 	flags.String("format", string(DefaultFormat), "The format to render the feed in (rss, atom, json)")
+	flags.String("mode", string(DefaultMode), "What each feed item represents (mods, updates)")
 	if err := GetViper().BindPFlags(flags); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadUnquotedDates(t *testing.T) {
+	c, err := Load(writeConfig(t, `
+updated-since: 2024-08-01
+added-before: 7d
+feeds:
+  - name: recent
+    added-since: 2024-07-01T10:00:00Z
+`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC); !c.UpdatedSince.At.Equal(want) {
+		t.Errorf("UpdatedSince = %v, want %v", c.UpdatedSince, want)
+	}
+	if want := 7 * 24 * time.Hour; c.AddedBefore.Ago != want {
+		t.Errorf("AddedBefore = %v, want %v ago", c.AddedBefore, want)
+	}
+	if len(c.Feeds) != 1 {
+		t.Fatalf("got %d feeds, want 1", len(c.Feeds))
+	}
+	if want := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC); !c.Feeds[0].AddedSince.At.Equal(want) {
+		t.Errorf("feed AddedSince = %v, want %v", c.Feeds[0].AddedSince, want)
+	}
+}
+
+func TestLoadInvalidDate(t *testing.T) {
+	if _, err := Load(writeConfig(t, "updated-since: 5\n")); err == nil {
+		t.Error("Load() error = nil, want an error for a number")
+	}
+}
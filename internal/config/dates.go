@@ -0,0 +1,137 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeBound is a point in time that is either absolute or relative to when
+// it is resolved.
+type TimeBound struct {
+	// At is an absolute point in time.
+	At time.Time
+	// Ago is a duration before the time the bound is resolved at. It is
+	// only used if At is zero.
+	Ago time.Duration
+}
+
+// ParseTimeBound parses an absolute timestamp (RFC 3339, "2006-01-02T15:04:05"
+// or "2006-01-02") or a duration relative to now (e.g. "72h", "7d" or "2w").
+func ParseTimeBound(s string) (TimeBound, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return TimeBound{At: t.UTC()}, nil
+		}
+	}
+	if d, err := parseDays(s); err == nil {
+		return TimeBound{Ago: d}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return TimeBound{Ago: d}, nil
+	}
+	return TimeBound{}, fmt.Errorf("invalid time: %q", s)
+}
+
+func parseDays(s string) (time.Duration, error) {
+	unit := 24 * time.Hour
+	switch {
+	case strings.HasSuffix(s, "d"):
+		s = strings.TrimSuffix(s, "d")
+	case strings.HasSuffix(s, "w"):
+		s = strings.TrimSuffix(s, "w")
+		unit *= 7
+	default:
+		return 0, fmt.Errorf("not a number of days or weeks: %q", s)
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("not a number of days or weeks: %q", s)
+	}
+	return time.Duration(n * float64(unit)), nil
+}
+
+// IsZero returns true if the bound is not set.
+func (b TimeBound) IsZero() bool {
+	return b.At.IsZero() && b.Ago == 0
+}
+
+// Resolve returns the point in time the bound represents relative to now.
+func (b TimeBound) Resolve(now time.Time) time.Time {
+	if !b.At.IsZero() {
+		return b.At
+	}
+	if b.Ago > 0 {
+		return now.Add(-b.Ago)
+	}
+	return time.Time{}
+}
+
+func (b *TimeBound) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*b = TimeBound{}
+		return nil
+	}
+	bound, err := ParseTimeBound(string(text))
+	if err != nil {
+		return err
+	}
+	*b = bound
+	return nil
+}
+
+func (b TimeBound) String() string {
+	if !b.At.IsZero() {
+		return b.At.Format(time.RFC3339Nano)
+	}
+	if b.Ago > 0 {
+		return b.Ago.String() + " ago"
+	}
+	return ""
+}
+
+// DateWindow are the bounds on the dates mods were added and updated to filter
+// mods by. Zero bounds are not applied.
+type DateWindow struct {
+	// AddedSince is the earliest time mods were added.
+	AddedSince TimeBound `mapstructure:"added-since"`
+	// AddedBefore is the time mods must have been added before.
+	AddedBefore TimeBound `mapstructure:"added-before"`
+	// UpdatedSince is the earliest time mods were last updated.
+	UpdatedSince TimeBound `mapstructure:"updated-since"`
+	// UpdatedBefore is the time mods must have been last updated before.
+	UpdatedBefore TimeBound `mapstructure:"updated-before"`
+}
+
+// Merge merges the given window into the current one and returns a new copy.
+func (w DateWindow) Merge(overrides DateWindow) DateWindow {
+	if !overrides.AddedSince.IsZero() {
+		w.AddedSince = overrides.AddedSince
+	}
+	if !overrides.AddedBefore.IsZero() {
+		w.AddedBefore = overrides.AddedBefore
+	}
+	if !overrides.UpdatedSince.IsZero() {
+		w.UpdatedSince = overrides.UpdatedSince
+	}
+	if !overrides.UpdatedBefore.IsZero() {
+		w.UpdatedBefore = overrides.UpdatedBefore
+	}
+	return w
+}
+
+func (w DateWindow) String() string {
+	var parts []string
+	add := func(name string, b TimeBound) {
+		if !b.IsZero() {
+			parts = append(parts, name+"="+b.String())
+		}
+	}
+	add("added_since", w.AddedSince)
+	add("added_before", w.AddedBefore)
+	add("updated_since", w.UpdatedSince)
+	add("updated_before", w.UpdatedBefore)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeBound(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    TimeBound
+		wantErr bool
+	}{
+		{in: "2024-08-01", want: TimeBound{At: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)}},
+		{in: "2024-08-01T10:30:00", want: TimeBound{At: time.Date(2024, 8, 1, 10, 30, 0, 0, time.UTC)}},
+		{in: "2024-08-01T10:30:00Z", want: TimeBound{At: time.Date(2024, 8, 1, 10, 30, 0, 0, time.UTC)}},
+		{in: "2024-08-01T12:30:00+02:00", want: TimeBound{At: time.Date(2024, 8, 1, 10, 30, 0, 0, time.UTC)}},
+		{in: " 2024-08-01 ", want: TimeBound{At: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)}},
+		{in: "72h", want: TimeBound{Ago: 72 * time.Hour}},
+		{in: "7d", want: TimeBound{Ago: 7 * 24 * time.Hour}},
+		{in: "1.5d", want: TimeBound{Ago: 36 * time.Hour}},
+		{in: "2w", want: TimeBound{Ago: 14 * 24 * time.Hour}},
+		{in: "", wantErr: true},
+		{in: "yesterday", wantErr: true},
+		{in: "2024-13-01", wantErr: true},
+		{in: "0d", wantErr: true},
+		{in: "-7d", wantErr: true},
+		{in: "-1h", wantErr: true},
+		{in: "d", wantErr: true},
+	} {
+		got, err := ParseTimeBound(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseTimeBound(%q) = %v, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTimeBound(%q) error = %v", tc.in, err)
+		} else if !got.At.Equal(tc.want.At) || got.Ago != tc.want.Ago {
+			t.Errorf("ParseTimeBound(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// FeedConfig are the options for generating a feed. Empty options in named
+// feeds fall back to the options of the default feed.
+type FeedConfig struct {
+	// Tags to filter mods by
+	Tags []string `mapstructure:"tags"`
+	// TagsMatch is how Tags are matched. Valid options are "any" and "all".
+	// Defaults to "any".
+	TagsMatch MatchMode `mapstructure:"tags-match"`
+	// TagsNot are tags to exclude mods by
+	TagsNot []string `mapstructure:"tags-not"`
+	// Search is text to filter mods by. Mods match if their name,
+	// summary or description contains it.
+	Search string `mapstructure:"search"`
+	// Thresholds are the minimum and maximum mod statistics to filter mods by.
+	Thresholds `mapstructure:",squash"`
+	// DateWindow are the bounds on when mods were added and updated.
+	DateWindow `mapstructure:",squash"`
+	// Platforms to filter mods by
+	Platforms []Platform `mapstructure:"platform"`
+	// PlatformMatch is how Platforms are matched. Valid options are "any"
+	// and "all". Defaults to "any".
+	PlatformMatch MatchMode `mapstructure:"platform-match"`
+	// MaxFeedItems is the maximum number of feed items to render.
+	// Defaults to 100 items.
+	MaxFeedItems int `mapstructure:"max-feed-items"`
+	// The field to sort the feed by. Defaults to "recent", or to
+	// "last_updated" in updates mode.
+	Sort string `mapstructure:"sort"`
+	// Format is the format to render the feed in. Valid options are
+	// "rss", "atom", and "json". Defaults to "atom".
+	Format FeedFormat `mapstructure:"format"`
+	// Mode is what each item in the feed represents. Valid options are
+	// "mods" and "updates". Defaults to "mods".
+	Mode FeedMode `mapstructure:"mode"`
+}
+
+// NamedFeed is a feed defined in the configuration file.
+type NamedFeed struct {
+	// Name is the name the feed is served under at /feeds/{name}.
+	Name string `mapstructure:"name"`
+	// Title is the title of the feed.
+	Title string `mapstructure:"title"`
+	// Description is the description of the feed.
+	Description string `mapstructure:"description"`
+	// FeedConfig are the options for generating the feed.
+	FeedConfig `mapstructure:",squash"`
+}
+
+// validate checks the options are valid. If required is false, empty
+// options are allowed.
+func (f FeedConfig) validate(required bool) error {
+	if (required || f.Format != "") && !f.Format.IsValid() {
+		return fmt.Errorf("invalid feed format: %s", f.Format)
+	}
+	for _, platform := range f.Platforms {
+		if !platform.IsValid() {
+			return fmt.Errorf("invalid platform: %s", platform)
+		}
+	}
+	if (required || f.PlatformMatch != "") && !f.PlatformMatch.IsValid() {
+		return fmt.Errorf("invalid platform match mode: %s", f.PlatformMatch)
+	}
+	if (required || f.TagsMatch != "") && !f.TagsMatch.IsValid() {
+		return fmt.Errorf("invalid tags match mode: %s", f.TagsMatch)
+	}
+	if (required || f.Mode != "") && !f.Mode.IsValid() {
+		return fmt.Errorf("invalid feed mode: %s", f.Mode)
+	}
+	return nil
+}
+
+// LogValue logs the options of a feed as a group.
+func (f FeedConfig) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("tags", strings.Join(f.Tags, ",")),
+		slog.String("tags_match", string(f.TagsMatch)),
+		slog.String("tags_not", strings.Join(f.TagsNot, ",")),
+		slog.String("search", f.Search),
+		slog.String("thresholds", f.Thresholds.String()),
+		slog.String("date_window", f.DateWindow.String()),
+		slog.String("platforms", JoinPlatforms(f.Platforms)),
+		slog.String("platform_match", string(f.PlatformMatch)),
+		slog.Int("max_feed_items", f.MaxFeedItems),
+		slog.String("sort", f.Sort),
+		slog.String("format", string(f.Format)),
+		slog.String("mode", string(f.Mode)),
+	)
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a size in bytes that can be parsed from strings like "50MB" or "1.5GiB".
+type ByteSize uint64
+
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"KIB", 1 << 10},
+	{"MIB", 1 << 20},
+	{"GIB", 1 << 30},
+	{"KB", 1e3},
+	{"MB", 1e6},
+	{"GB", 1e9},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size with an optional unit suffix. Decimal (KB, MB, GB)
+// and binary (KiB, MiB, GiB, K, M, G) units are supported. Sizes without a
+// unit are in bytes. Negative, non-finite and out of range sizes are rejected.
+func ParseByteSize(s string) (ByteSize, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := 1.0
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	// NaN and infinite sizes parse as floats, and sizes too large for a
+	// ByteSize would wrap around when converted
+	if err != nil || n < 0 || math.IsNaN(n) || n*multiplier >= math.MaxUint64 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return ByteSize(n * multiplier), nil
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*b = 0
+		return nil
+	}
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+func (b ByteSize) String() string {
+	return strconv.FormatUint(uint64(b), 10)
+}
@@ -0,0 +1,42 @@
+package config
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    ByteSize
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "512", want: 512},
+		{in: "512B", want: 512},
+		{in: "50MB", want: 50_000_000},
+		{in: "50mb", want: 50_000_000},
+		{in: " 2 KB ", want: 2_000},
+		{in: "1.5GiB", want: 1536 << 20},
+		{in: "1K", want: 1 << 10},
+		{in: "3M", want: 3 << 20},
+		{in: "1G", want: 1 << 30},
+		{in: "", wantErr: true},
+		{in: "50XB", wantErr: true},
+		{in: "-1MB", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "Inf", wantErr: true},
+		{in: "+InfMB", wantErr: true},
+		{in: "1e30GB", wantErr: true},
+	} {
+		got, err := ParseByteSize(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseByteSize(%q) = %v, want an error", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseByteSize(%q) error = %v", tc.in, err)
+		} else if got != tc.want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Thresholds are the minimum and maximum values of mod statistics to filter
+// mods by. Zero values are not applied.
+type Thresholds struct {
+	// MinDownloads is the minimum number of total downloads.
+	MinDownloads int `mapstructure:"min-downloads"`
+	// MaxDownloads is the maximum number of total downloads.
+	MaxDownloads int `mapstructure:"max-downloads"`
+	// MinSubscribers is the minimum number of subscribers.
+	MinSubscribers int `mapstructure:"min-subscribers"`
+	// MaxSubscribers is the maximum number of subscribers.
+	MaxSubscribers int `mapstructure:"max-subscribers"`
+	// MinRating is the minimum weighted rating, between 0 and 1.
+	MinRating float64 `mapstructure:"min-rating"`
+	// MaxRating is the maximum weighted rating, between 0 and 1.
+	MaxRating float64 `mapstructure:"max-rating"`
+	// MinPositive is the minimum percentage of positive ratings, between 0 and 100.
+	MinPositive float64 `mapstructure:"min-positive"`
+	// MaxPositive is the maximum percentage of positive ratings, between 0 and 100.
+	MaxPositive float64 `mapstructure:"max-positive"`
+	// MinFilesize is the minimum size of the mod's file.
+	MinFilesize ByteSize `mapstructure:"min-filesize"`
+	// MaxFilesize is the maximum size of the mod's file.
+	MaxFilesize ByteSize `mapstructure:"max-filesize"`
+}
+
+// Merge merges the given thresholds into the current ones and returns a new copy.
+func (t Thresholds) Merge(overrides Thresholds) Thresholds {
+	if overrides.MinDownloads > 0 {
+		t.MinDownloads = overrides.MinDownloads
+	}
+	if overrides.MaxDownloads > 0 {
+		t.MaxDownloads = overrides.MaxDownloads
+	}
+	if overrides.MinSubscribers > 0 {
+		t.MinSubscribers = overrides.MinSubscribers
+	}
+	if overrides.MaxSubscribers > 0 {
+		t.MaxSubscribers = overrides.MaxSubscribers
+	}
+	if overrides.MinRating > 0 {
+		t.MinRating = overrides.MinRating
+	}
+	if overrides.MaxRating > 0 {
+		t.MaxRating = overrides.MaxRating
+	}
+	if overrides.MinPositive > 0 {
+		t.MinPositive = overrides.MinPositive
+	}
+	if overrides.MaxPositive > 0 {
+		t.MaxPositive = overrides.MaxPositive
+	}
+	if overrides.MinFilesize > 0 {
+		t.MinFilesize = overrides.MinFilesize
+	}
+	if overrides.MaxFilesize > 0 {
+		t.MaxFilesize = overrides.MaxFilesize
+	}
+	return t
+}
+
+func (t Thresholds) String() string {
+	var parts []string
+	add := func(name string, value any, set bool) {
+		if set {
+			parts = append(parts, fmt.Sprintf("%s=%v", name, value))
+		}
+	}
+	add("min_downloads", t.MinDownloads, t.MinDownloads > 0)
+	add("max_downloads", t.MaxDownloads, t.MaxDownloads > 0)
+	add("min_subscribers", t.MinSubscribers, t.MinSubscribers > 0)
+	add("max_subscribers", t.MaxSubscribers, t.MaxSubscribers > 0)
+	add("min_rating", t.MinRating, t.MinRating > 0)
+	add("max_rating", t.MaxRating, t.MaxRating > 0)
+	add("min_positive", t.MinPositive, t.MinPositive > 0)
+	add("max_positive", t.MaxPositive, t.MaxPositive > 0)
+	add("min_filesize", t.MinFilesize, t.MinFilesize > 0)
+	add("max_filesize", t.MaxFilesize, t.MaxFilesize > 0)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,166 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+	"github.com/tinyzimmer/bg3mods-feed/internal/store"
+)
+
+type cacheKey struct {
+	title         string
+	description   string
+	maxItems      int
+	sort          string
+	tags          string
+	tagsMatch     config.MatchMode
+	tagsNot       string
+	search        string
+	thresholds    config.Thresholds
+	dates         config.DateWindow
+	platforms     string
+	platformMatch config.MatchMode
+	author        string
+	mode          config.FeedMode
+	mod           string
+}
+
+func newCacheKey(opts GeneratorOptions) cacheKey {
+	return cacheKey{
+		title:         opts.Title,
+		description:   opts.Description,
+		maxItems:      opts.MaxItems,
+		sort:          opts.GetSort(),
+		tags:          strings.Join(opts.Tags, ","),
+		tagsMatch:     opts.TagsMatch,
+		tagsNot:       strings.Join(opts.TagsNot, ","),
+		search:        strings.ToLower(opts.Search),
+		thresholds:    opts.Thresholds,
+		dates:         opts.Dates,
+		platforms:     config.JoinPlatforms(opts.Platforms),
+		platformMatch: opts.PlatformMatch,
+		author:        opts.Author,
+		mode:          opts.Mode,
+	}
+}
+
+func (k cacheKey) String() string {
+	if k.mod != "" {
+		return fmt.Sprintf("mod=%q;max_items=%d", k.mod, k.maxItems)
+	}
+	// Free text is quoted so that it cannot be mistaken for other fields
+	return fmt.Sprintf("title=%q;description=%q;max_items=%d;sort=%s;tags=%q;tags_match=%s;tags_not=%q;search=%q;thresholds=%s;dates=%s;platforms=%s;platform_match=%s;author=%q;mode=%s",
+		k.title, k.description, k.maxItems, k.sort, k.tags, k.tagsMatch, k.tagsNot, k.search, k.thresholds, k.dates, k.platforms, k.platformMatch, k.author, k.mode)
+}
+
+// shape names the filters set in the key, so keys can be grouped in metrics
+// without a label for every distinct key. Feeds with no filters are "all".
+func (k cacheKey) shape() string {
+	if k.mod != "" {
+		return "mod"
+	}
+	var filters []string
+	for _, filter := range []struct {
+		name string
+		set  bool
+	}{
+		{"author", k.author != ""},
+		{"tags", k.tags != ""},
+		{"tags_not", k.tagsNot != ""},
+		{"search", k.search != ""},
+		{"thresholds", k.thresholds != config.Thresholds{}},
+		{"dates", k.dates != config.DateWindow{}},
+		{"platforms", k.platforms != ""},
+		{"updates", k.mode == config.ModeUpdates},
+	} {
+		if filter.set {
+			filters = append(filters, filter.name)
+		}
+	}
+	if len(filters) == 0 {
+		return "all"
+	}
+	return strings.Join(filters, "+")
+}
+
+// cachedFeed is a feed known to the generator. The feed is nil until it
+// has been built for the first time.
+type cachedFeed struct {
+	// src is used to refresh the feed and never changes.
+	src source
+
+	mu   sync.RWMutex
+	feed *modFeed
+	at   time.Time
+	// opts are the options the feed is refreshed with.
+	opts GeneratorOptions
+	// pinned feeds are never evicted.
+	pinned bool
+	// requestedAt is the time the feed was last requested.
+	requestedAt time.Time
+	// refreshedAt is the time a refresh of the feed was last attempted.
+	refreshedAt time.Time
+}
+
+func (c *cachedFeed) get() (*modFeed, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.feed, c.at
+}
+
+func (c *cachedFeed) set(feed *modFeed, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.feed, c.at = feed, at
+}
+
+// entry returns the cached feed for the given key, creating it if it does not exist.
+// The boolean is true if the entry already existed. The options are only used
+// for new entries, so that options a request may override without changing
+// the key, like the fetch interval, do not change how a shared feed is
+// refreshed.
+func (g *generator) entry(key cacheKey, opts GeneratorOptions, src source) (*cachedFeed, bool) {
+	g.cachedDataMux.RLock()
+	entry, ok := g.cachedData[key]
+	g.cachedDataMux.RUnlock()
+	if !ok {
+		g.cachedDataMux.Lock()
+		entry, ok = g.cachedData[key]
+		if !ok {
+			entry = &cachedFeed{src: src, opts: opts}
+			g.cachedData[key] = entry
+		}
+		g.cachedDataMux.Unlock()
+	}
+	return entry, ok
+}
+
+// records looks up the store records for the given mods. If the store cannot
+// be read, records holding only the mods as fetched are returned instead.
+func (g *generator) records(ctx context.Context, modList []mods.Mod) []*store.ModRecord {
+	ids := make([]int, len(modList))
+	for i, mod := range modList {
+		ids[i] = mod.ID
+	}
+	records, err := g.store.GetMods(ctx, ids)
+	if err == nil && len(records) == len(modList) {
+		return records
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to load mod records", "error", err)
+	}
+	records = make([]*store.ModRecord, len(modList))
+	for i, mod := range modList {
+		records[i] = &store.ModRecord{
+			Mod:      mod,
+			Modfiles: []store.ModfileRecord{{Modfile: mod.Modfile}},
+		}
+	}
+	return records
+}
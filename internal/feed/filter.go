@@ -0,0 +1,101 @@
+package feed
+
+import (
+	"time"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+)
+
+// matches returns true if the given mod passes the filters in the options.
+// Relative dates are resolved against now.
+func (g GeneratorOptions) matches(mod mods.Mod, now time.Time) bool {
+	if !g.matchesPlatforms(mod) {
+		return false
+	}
+	if g.Author != "" && mod.SubmittedBy.NameID != g.Author {
+		return false
+	}
+	if !g.matchesTags(mod) {
+		return false
+	}
+	if g.Search != "" && !mod.Mentions(g.Search) {
+		return false
+	}
+	if !matchesThresholds(g.Thresholds, mod) {
+		return false
+	}
+	if !matchesDates(g.Dates, mod, now) {
+		return false
+	}
+	return true
+}
+
+func matchesDates(w config.DateWindow, mod mods.Mod, now time.Time) bool {
+	inBounds := func(t time.Time, since, before config.TimeBound) bool {
+		if !since.IsZero() && t.Before(since.Resolve(now)) {
+			return false
+		}
+		if !before.IsZero() && !t.Before(before.Resolve(now)) {
+			return false
+		}
+		return true
+	}
+	return inBounds(mod.DateAdded(), w.AddedSince, w.AddedBefore) &&
+		inBounds(mod.DateUpdated(), w.UpdatedSince, w.UpdatedBefore)
+}
+
+func matchesThresholds(t config.Thresholds, mod mods.Mod) bool {
+	stats := mod.Stats
+	switch {
+	case t.MinDownloads > 0 && stats.DownloadsTotal < t.MinDownloads,
+		t.MaxDownloads > 0 && stats.DownloadsTotal > t.MaxDownloads,
+		t.MinSubscribers > 0 && stats.SubscribersTotal < t.MinSubscribers,
+		t.MaxSubscribers > 0 && stats.SubscribersTotal > t.MaxSubscribers,
+		t.MinRating > 0 && stats.RatingsWeightedAggregate < t.MinRating,
+		t.MaxRating > 0 && stats.RatingsWeightedAggregate > t.MaxRating,
+		t.MinPositive > 0 && stats.RatingsPercentagePositive < t.MinPositive,
+		t.MaxPositive > 0 && stats.RatingsPercentagePositive > t.MaxPositive,
+		t.MinFilesize > 0 && mod.Modfile.Filesize < uint64(t.MinFilesize),
+		t.MaxFilesize > 0 && mod.Modfile.Filesize > uint64(t.MaxFilesize):
+		return false
+	}
+	return true
+}
+
+func (g GeneratorOptions) matchesPlatforms(mod mods.Mod) bool {
+	if len(g.Platforms) == 0 {
+		return true
+	}
+	for _, platform := range g.Platforms {
+		supported := mod.SupportsPlatform(platform)
+		if g.PlatformMatch == config.MatchAll && !supported {
+			return false
+		}
+		if g.PlatformMatch != config.MatchAll && supported {
+			return true
+		}
+	}
+	return g.PlatformMatch == config.MatchAll
+}
+
+func (g GeneratorOptions) matchesTags(mod mods.Mod) bool {
+	for _, tag := range g.TagsNot {
+		if mod.HasTag(tag) {
+			return false
+		}
+	}
+	if len(g.Tags) == 0 {
+		return true
+	}
+	for _, tag := range g.Tags {
+		has := mod.HasTag(tag)
+		if g.TagsMatch == config.MatchAll && !has {
+			return false
+		}
+		if g.TagsMatch != config.MatchAll && has {
+			return true
+		}
+	}
+	return g.TagsMatch == config.MatchAll
+}
@@ -0,0 +1,55 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+)
+
+func TestMatchesTags(t *testing.T) {
+	mod := mods.Mod{Tags: []mods.Tag{{Name: "Gameplay"}, {Name: "Classes"}}}
+	for _, tc := range []struct {
+		name string
+		opts GeneratorOptions
+		want bool
+	}{
+		{name: "no tags", want: true},
+		{name: "any with one present", opts: GeneratorOptions{Tags: []string{"Spells", "Classes"}}, want: true},
+		{name: "any ignores case", opts: GeneratorOptions{Tags: []string{"gameplay"}, TagsMatch: config.MatchAny}, want: true},
+		{name: "any with none present", opts: GeneratorOptions{Tags: []string{"Spells", "Maps"}}, want: false},
+		{name: "all present", opts: GeneratorOptions{Tags: []string{"Gameplay", "Classes"}, TagsMatch: config.MatchAll}, want: true},
+		{name: "all with one missing", opts: GeneratorOptions{Tags: []string{"Gameplay", "Spells"}, TagsMatch: config.MatchAll}, want: false},
+		{name: "excluded tag", opts: GeneratorOptions{TagsNot: []string{"classes"}}, want: false},
+		{name: "excluded tag absent", opts: GeneratorOptions{TagsNot: []string{"Maps"}}, want: true},
+		{name: "excluded tag wins", opts: GeneratorOptions{Tags: []string{"Gameplay"}, TagsNot: []string{"Classes"}}, want: false},
+	} {
+		if got := tc.opts.matchesTags(mod); got != tc.want {
+			t.Errorf("%s: matchesTags() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMatchesPlatforms(t *testing.T) {
+	mod := mods.Mod{Modfile: mods.Modfile{Platforms: []mods.Platform{
+		{Platform: "windows", Status: 1},
+		{Platform: "mac", Status: 1},
+		{Platform: "ps5", Status: 0},
+	}}}
+	for _, tc := range []struct {
+		name string
+		opts GeneratorOptions
+		want bool
+	}{
+		{name: "no platforms", want: true},
+		{name: "any with one supported", opts: GeneratorOptions{Platforms: []config.Platform{config.PlatformXBoxSeriesX, config.PlatformMac}}, want: true},
+		{name: "any with none supported", opts: GeneratorOptions{Platforms: []config.Platform{config.PlatformXBoxSeriesX}, PlatformMatch: config.MatchAny}, want: false},
+		{name: "any with pending platform", opts: GeneratorOptions{Platforms: []config.Platform{config.PlatformPS5}}, want: false},
+		{name: "all supported", opts: GeneratorOptions{Platforms: []config.Platform{config.PlatformWindows, config.PlatformMac}, PlatformMatch: config.MatchAll}, want: true},
+		{name: "all with pending platform", opts: GeneratorOptions{Platforms: []config.Platform{config.PlatformWindows, config.PlatformPS5}, PlatformMatch: config.MatchAll}, want: false},
+	} {
+		if got := tc.opts.matchesPlatforms(mod); got != tc.want {
+			t.Errorf("%s: matchesPlatforms() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
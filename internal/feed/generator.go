@@ -2,152 +2,380 @@ package feed
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
 	"sync"
 	"time"
 
-	"github.com/gorilla/feeds"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 
+	"github.com/tinyzimmer/bg3mods-feed/internal/catalog"
 	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+	"github.com/tinyzimmer/bg3mods-feed/internal/metrics"
 	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+	"github.com/tinyzimmer/bg3mods-feed/internal/store"
+	"github.com/tinyzimmer/bg3mods-feed/internal/tracing"
 )
 
+// tracer returns the tracer for the package. It is looked up from the global
+// tracer provider on every use rather than once at init, so that spans are
+// not tied to a provider that tracing.Setup has since replaced.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/tinyzimmer/bg3mods-feed/internal/feed")
+}
+
 // Generator is an interface for generating feeds of mods.
 type Generator interface {
 	// GetFeed generates a feed of mods based on the given options.
 	GetFeed(context.Context, GeneratorOptions) (*Feed, error)
+	// GetModFeed generates a feed of the releases of the mod with the given
+	// name ID. ErrModNotFound is returned if there is no such mod.
+	GetModFeed(context.Context, string, GeneratorOptions) (*Feed, error)
+	// Watch registers a feed to be kept up to date in the background for as
+	// long as the generator runs, whether or not it is requested.
+	Watch(context.Context, GeneratorOptions)
+	// Run syncs the catalog and refreshes known feeds in the background
+	// whenever they are older than their fetch interval. It blocks until
+	// the context is done.
+	Run(context.Context)
+	// Status returns the state of the catalog and cached feeds.
+	Status() Status
 }
 
+// Status is the state of a generator.
+type Status struct {
+	catalog.Status
+	// Feeds is the number of feeds in the cache.
+	Feeds int `json:"feeds"`
+	// StaleFeeds is the number of feeds in the cache that were not refreshed
+	// within their fetch interval.
+	StaleFeeds int `json:"stale_feeds"`
+}
+
+// ErrModNotFound is returned when a feed is requested for a mod that does not exist.
+var ErrModNotFound = errors.New("mod not found")
+
 // Feed represents a feed of mods.
 type Feed struct {
 	// Content is the raw feed content.
 	Content []byte
 	// Format is the format of the feed.
 	Format config.FeedFormat
-	// SyncedAt is the time the feed was last syncedm
+	// SyncedAt is the time the feed was last synced.
 	SyncedAt time.Time
+	// ExpiresAt is the time the feed is due to be refreshed.
+	ExpiresAt time.Time
+	// Stale is true if the feed was not refreshed within its fetch interval,
+	// usually because the last refresh failed.
+	Stale bool
 }
 
 type generator struct {
+	catalog  catalog.Catalog
 	api      mods.Fetcher
+	store    store.Store
 	defaults GeneratorOptions
 
 	cachedData    map[cacheKey]*cachedFeed
-	cachedDataMux sync.Mutex
+	cachedDataMux sync.RWMutex
+	// inflight coalesces concurrent fetches of the same feed.
+	inflight singleflight.Group
 }
 
-type cacheKey struct {
-	maxItems int
-	sort     string
-	tags     string
-	platform config.Platform
+// source describes how the mods for a feed are fetched and how the feed is
+// built from their records. fetch also returns the time the mods were synced.
+type source struct {
+	fetch func(context.Context, GeneratorOptions) ([]mods.Mod, time.Time, error)
+	build func(GeneratorOptions, []*store.ModRecord) *modFeed
 }
 
-type cachedFeed struct {
-	feed *feeds.Feed
-	at   time.Time
-}
-
-// NewGenerator creates a new feed generator using the given fetcher and default options.
-func NewGenerator(fetcher mods.Fetcher, defaults GeneratorOptions) Generator {
+// NewGenerator creates a new feed generator using the given catalog, fetcher, store and default
+// options. Feeds of mods are filtered and sorted from the catalog, which is synced every default
+// fetch interval. The fetcher is only used for the releases of individual mods, which are
+// recorded in the store.
+func NewGenerator(catalog catalog.Catalog, fetcher mods.Fetcher, store store.Store, defaults GeneratorOptions) Generator {
 	return &generator{
+		catalog:    catalog,
 		api:        fetcher,
+		store:      store,
 		defaults:   defaults,
 		cachedData: make(map[cacheKey]*cachedFeed),
 	}
 }
 
 func (g *generator) GetFeed(ctx context.Context, overrides GeneratorOptions) (*Feed, error) {
-	g.cachedDataMux.Lock()
-	defer g.cachedDataMux.Unlock()
+	opts := g.defaults.Merge(overrides)
+	// Feeds cannot be fresher than the catalog they are built from
+	opts.FetchInterval = max(opts.FetchInterval, g.defaults.FetchInterval)
+	key := newCacheKey(opts)
+	ctx, span := tracer().Start(ctx, "feed.GetFeed", trace.WithAttributes(
+		attribute.String("feed.shape", key.shape()),
+		attribute.String("feed.format", string(opts.Format)),
+	))
+	defer span.End()
+	data, err := g.getFeed(ctx, key, opts, g.feedSource())
+	return data, tracing.RecordError(span, err)
+}
 
+func (g *generator) GetModFeed(ctx context.Context, nameID string, overrides GeneratorOptions) (*Feed, error) {
 	opts := g.defaults.Merge(overrides)
 	key := cacheKey{
 		maxItems: opts.MaxItems,
-		sort:     opts.GetSort(),
-		tags:     strings.Join(opts.Tags, ","),
-		platform: opts.Platform,
+		mod:      nameID,
 	}
-	current := g.cachedData[key]
-	if current == nil || time.Since(current.at) > opts.FetchInterval {
-		feed, err := g.generate(ctx, opts)
-		if err != nil {
+	ctx, span := tracer().Start(ctx, "feed.GetModFeed", trace.WithAttributes(
+		attribute.String("feed.mod", nameID),
+		attribute.String("feed.format", string(opts.Format)),
+	))
+	defer span.End()
+	data, err := g.getFeed(ctx, key, opts, source{
+		fetch: func(ctx context.Context, opts GeneratorOptions) ([]mods.Mod, time.Time, error) {
+			return g.generateMod(ctx, nameID, opts)
+		},
+		build: buildModFeed,
+	})
+	if errors.Is(err, ErrModNotFound) {
+		// A missing mod is the client's error rather than the server's
+		return nil, err
+	}
+	return data, tracing.RecordError(span, err)
+}
+
+func (g *generator) feedSource() source {
+	return source{
+		fetch: g.generate,
+		build: buildFeed,
+	}
+}
+
+// getFeed serves the feed for the given key from the cache. Feeds that have
+// never been fetched are fetched before returning, and are then kept up to
+// date by Run. Feeds that Run has not managed to refresh within their fetch
+// interval are served stale, and refreshed in the background. Feeds built from
+// a catalog that is itself out of date are also marked stale.
+func (g *generator) getFeed(ctx context.Context, key cacheKey, opts GeneratorOptions, src source) (*Feed, error) {
+	entry, _ := g.entry(key, opts, src)
+	entry.mu.Lock()
+	entry.requestedAt = time.Now()
+	// Freshness follows the interval the shared entry is refreshed on, not
+	// one the request asked for
+	interval := entry.opts.FetchInterval
+	entry.mu.Unlock()
+
+	var stale bool
+	current, at := entry.get()
+	if current == nil {
+		recordLookup(ctx, key, "miss")
+		if err := g.refresh(ctx, key, entry); err != nil {
+			g.evictUnfetched(key, entry)
 			return nil, err
 		}
-		g.cachedData[key] = &cachedFeed{
-			feed: feed,
-			at:   time.Now().UTC(),
+		current, at = entry.get()
+		if current == nil {
+			return nil, errors.New("feed was not built")
 		}
-		current = g.cachedData[key]
+		// A new feed is built from the catalog as last synced, which may
+		// itself be stale
+		stale = g.isStale(at, interval)
+	} else if g.isStale(at, interval) {
+		slog.DebugContext(ctx, "Using stale feed data", "key", key.String(), "synced_at", at)
+		recordLookup(ctx, key, "stale")
+		stale = true
+		g.revalidate(ctx, key, entry)
 	} else {
-		log.Println("Using cached feed data from", current.at)
+		slog.DebugContext(ctx, "Using cached feed data", "key", key.String(), "synced_at", at)
+		recordLookup(ctx, key, "hit")
 	}
 
-	var data string
-	var err error
-	switch opts.Format {
-	case config.FormatRSS:
-		data, err = current.feed.ToRss()
-	case config.FormatAtom:
-		data, err = current.feed.ToAtom()
-	case config.FormatJSON:
-		data, err = current.feed.ToJSON()
-	}
+	data, err := current.render(opts.Format)
 	if err != nil {
 		return nil, fmt.Errorf("failed to render feed: %w", err)
 	}
 	return &Feed{
-		Content:  []byte(data),
-		Format:   opts.Format,
-		SyncedAt: current.at,
+		Content:   []byte(data),
+		Format:    opts.Format,
+		SyncedAt:  at,
+		ExpiresAt: at.Add(interval),
+		Stale:     stale,
 	}, nil
 }
 
-func (g *generator) generate(ctx context.Context, opts GeneratorOptions) (*feeds.Feed, error) {
-	limit := 100
-	if opts.MaxItems > 0 && opts.MaxItems < limit {
-		limit = opts.MaxItems
+// recordLookup records the result of looking up a feed in the cache in
+// metrics and the current span.
+func recordLookup(ctx context.Context, key cacheKey, result string) {
+	metrics.CacheLookups.WithLabelValues(key.shape(), result).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("feed.cache", result))
+}
+
+// revalidate refreshes a stale feed in the background, unless a refresh has
+// already been attempted within its fetch interval.
+func (g *generator) revalidate(ctx context.Context, key cacheKey, entry *cachedFeed) {
+	entry.mu.Lock()
+	if time.Since(entry.refreshedAt) < entry.opts.FetchInterval {
+		entry.mu.Unlock()
+		return
 	}
+	entry.refreshedAt = time.Now()
+	entry.mu.Unlock()
+	go func() {
+		if err := g.refresh(context.WithoutCancel(ctx), key, entry); err != nil {
+			slog.WarnContext(ctx, "Failed to refresh feed", "key", key.String(), "error", err)
+		}
+	}()
+}
 
-	var offset int
-	feed := &feeds.Feed{
-		Title:       "BG3 Mods Feed",
-		Link:        &feeds.Link{Href: ""},
-		Description: "A feed of the latest mods for Baldur's Gate 3",
+// refresh fetches the mods for a cached feed and rebuilds it. Concurrent
+// calls for the same feed share a single fetch. The result is set on the
+// entry of every caller, as entries evicted and recreated while a fetch is
+// in flight share it without having started it.
+func (g *generator) refresh(ctx context.Context, key cacheKey, entry *cachedFeed) error {
+	res, err := g.coalesce(ctx, key, func(ctx context.Context) (*fetchedFeed, error) {
+		return g.fetch(ctx, entry)
+	})
+	if err != nil {
+		return err
 	}
+	entry.set(res.feed, res.at)
+	return nil
+}
 
-	for {
+// fetchedFeed is a feed built by a fetch, and the time it was synced at.
+type fetchedFeed struct {
+	feed *modFeed
+	at   time.Time
+}
+
+// coalesce runs fn once for all concurrent callers with the same key. fn is
+// not canceled when a caller's context is, so the result can still be cached
+// for the other callers.
+func (g *generator) coalesce(ctx context.Context, key cacheKey, fn func(context.Context) (*fetchedFeed, error)) (*fetchedFeed, error) {
+	ch := g.inflight.DoChan(key.String(), func() (any, error) {
+		return fn(context.WithoutCancel(ctx))
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*fetchedFeed), nil
+	}
+}
+
+// fetch fetches the mods for a cached feed and rebuilds it, setting it on
+// the entry even if the callers waiting for it have gone away.
+func (g *generator) fetch(ctx context.Context, entry *cachedFeed) (*fetchedFeed, error) {
+	entry.mu.Lock()
+	entry.refreshedAt = time.Now()
+	opts := entry.opts
+	entry.mu.Unlock()
+	modList, at, err := entry.src.fetch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	res := &fetchedFeed{
+		feed: entry.src.build(opts, g.records(ctx, modList)),
+		at:   at,
+	}
+	entry.set(res.feed, res.at)
+	return res, nil
+}
+
+// evictUnfetched removes a feed from the cache if it has never been fetched
+// and was not registered with Watch, so failing requests are not retried in
+// the background.
+func (g *generator) evictUnfetched(key cacheKey, entry *cachedFeed) {
+	g.cachedDataMux.Lock()
+	defer g.cachedDataMux.Unlock()
+	entry.mu.RLock()
+	defer entry.mu.RUnlock()
+	if entry.feed == nil && !entry.pinned && g.cachedData[key] == entry {
+		delete(g.cachedData, key)
+	}
+}
+
+// generate selects the mods matching the given options from the catalog,
+// syncing it first if it has never been synced.
+func (g *generator) generate(ctx context.Context, opts GeneratorOptions) ([]mods.Mod, time.Time, error) {
+	ctx, span := tracer().Start(ctx, "feed.generate")
+	defer span.End()
+	if g.catalog.SyncedAt().IsZero() {
+		if err := g.catalog.Sync(ctx); err != nil {
+			return nil, time.Time{}, tracing.RecordError(span, err)
+		}
+	}
+	now := time.Now().UTC()
+	modList, syncedAt := g.catalog.Select(func(mod mods.Mod) bool {
+		return opts.matches(mod, now)
+	})
+	if err := mods.SortMods(modList, opts.GetSort()); err != nil {
+		return nil, time.Time{}, tracing.RecordError(span, err)
+	}
+	if opts.MaxItems > 0 && len(modList) > opts.MaxItems {
+		modList = modList[:opts.MaxItems]
+	}
+	span.SetAttributes(attribute.Int("feed.mods", len(modList)))
+	return modList, syncedAt, nil
+}
+
+// generateMod fetches the releases of the mod with the given name ID and records
+// them in the store. The mod is looked up in the catalog, or fetched if it was
+// added since the catalog was last synced.
+func (g *generator) generateMod(ctx context.Context, nameID string, opts GeneratorOptions) ([]mods.Mod, time.Time, error) {
+	// The feed is considered synced as of when the fetch started, so that it
+	// is refreshed on the first check after its fetch interval has passed.
+	at := time.Now().UTC()
+	mod, ok := g.catalog.Lookup(nameID)
+	if !ok {
 		res, err := g.api.Fetch(ctx, mods.FetchOptions{
+			Limit:  1,
+			NameID: nameID,
+		})
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to fetch mod: %w", err)
+		}
+		if len(res.Data) == 0 || res.Data[0].NameID != nameID {
+			return nil, time.Time{}, ErrModNotFound
+		}
+		mod = res.Data[0]
+		if err := g.store.PutMods(ctx, res.Data, time.Now().UTC()); err != nil {
+			slog.WarnContext(ctx, "Failed to record fetched mods", "error", err)
+		}
+	}
+
+	limit := 100
+	if opts.MaxItems > 0 && opts.MaxItems < limit {
+		limit = opts.MaxItems
+	}
+	var offset int
+	for opts.MaxItems <= 0 || offset < opts.MaxItems {
+		files, err := g.api.FetchModfiles(ctx, mod.ID, mods.FetchOptions{
 			Limit:  limit,
 			Offset: offset,
-			Tags:   opts.Tags,
-			Sort:   opts.GetSort(),
+			Sort:   "-date_added",
 		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch mods: %w", err)
-		}
-		for _, mod := range res.Data {
-			if opts.MaxItems > 0 && len(feed.Items) >= opts.MaxItems {
-				return feed, nil
+			if offset == 0 {
+				// The feed is served stale until the releases can be fetched
+				return nil, time.Time{}, fmt.Errorf("failed to fetch modfiles: %w", err)
 			}
-			if opts.Platform.IsValid() && !mod.SupportsPlatform(opts.Platform) {
-				continue
-			}
-			feed.Items = append(feed.Items, &feeds.Item{
-				Id:          mod.NameID,
-				Title:       mod.Name,
-				Link:        &feeds.Link{Href: mod.ProfileURL},
-				Description: mod.Summary,
-				Created:     mod.DateAdded(),
-				Updated:     mod.DateUpdated(),
-				Content:     mod.Description,
-			})
+			// The first page holds the newest releases, so the feed is up to
+			// date with the releases recorded so far
+			slog.WarnContext(ctx, "Failed to fetch modfiles", "mod", nameID, "offset", offset, "error", err)
+			break
+		}
+		if err := g.store.PutModfiles(ctx, mod.ID, files.Data, time.Now().UTC()); err != nil {
+			slog.WarnContext(ctx, "Failed to record fetched modfiles", "mod", nameID, "error", err)
 		}
 		offset += limit
-		if len(res.Data) < limit {
-			return feed, nil
+		if len(files.Data) < limit {
+			break
 		}
 	}
+	return []mods.Mod{mod}, at, nil
 }
@@ -0,0 +1,262 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/catalog"
+	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+	"github.com/tinyzimmer/bg3mods-feed/internal/store"
+)
+
+// slowCatalog is a catalog whose first sync blocks until it is released.
+type slowCatalog struct {
+	mods    []mods.Mod
+	release chan struct{}
+	syncs   atomic.Int32
+
+	mu       sync.Mutex
+	syncedAt time.Time
+}
+
+func newSlowCatalog() *slowCatalog {
+	return &slowCatalog{
+		mods: []mods.Mod{
+			{ID: 1, NameID: "one", Name: "One", DateUpdatedEpoch: uint64(time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC).Unix())},
+			{ID: 2, NameID: "two", Name: "Two", DateUpdatedEpoch: uint64(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC).Unix())},
+		},
+		release: make(chan struct{}),
+	}
+}
+
+func (c *slowCatalog) Load(context.Context) error { return nil }
+
+func (c *slowCatalog) Sync(ctx context.Context) error {
+	c.syncs.Add(1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.release:
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.syncedAt = time.Now().UTC()
+	return nil
+}
+
+func (c *slowCatalog) Select(match func(mods.Mod) bool) ([]mods.Mod, time.Time) {
+	var selected []mods.Mod
+	for _, mod := range c.mods {
+		if match(mod) {
+			selected = append(selected, mod)
+		}
+	}
+	return selected, c.SyncedAt()
+}
+
+func (c *slowCatalog) Lookup(nameID string) (mods.Mod, bool) {
+	for _, mod := range c.mods {
+		if mod.NameID == nameID {
+			return mod, true
+		}
+	}
+	return mods.Mod{}, false
+}
+
+func (c *slowCatalog) SyncedAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.syncedAt
+}
+
+func (c *slowCatalog) Status() catalog.Status {
+	return catalog.Status{SyncedAt: c.SyncedAt()}
+}
+
+// noFetcher is a fetcher for feeds that are only built from the catalog.
+type noFetcher struct{}
+
+func (noFetcher) Fetch(context.Context, mods.FetchOptions) (*mods.GetModsResponse, error) {
+	return nil, errors.New("unexpected fetch")
+}
+
+func (noFetcher) FetchModfiles(context.Context, int, mods.FetchOptions) (*mods.GetModfilesResponse, error) {
+	return nil, errors.New("unexpected fetch")
+}
+
+func newTestGenerator(c catalog.Catalog) Generator {
+	return NewGenerator(c, noFetcher{}, store.NewMemoryStore(), GeneratorOptions{
+		MaxItems:      10,
+		Sort:          config.DefaultSort,
+		FetchInterval: time.Minute,
+		Format:        config.FormatRSS,
+		Mode:          config.ModeMods,
+	})
+}
+
+func optionsFromQuery(t *testing.T, query string) GeneratorOptions {
+	t.Helper()
+	u, err := url.Parse("/feed?" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := OptionsFromQuery(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+// TestGetFeedConcurrentMisses requests feeds that have not been built yet
+// concurrently, including feeds whose options only differ below a second.
+func TestGetFeedConcurrentMisses(t *testing.T) {
+	c := newSlowCatalog()
+	g := newTestGenerator(c)
+	queries := []string{
+		"",
+		"updated_since=2024-08-01T00:00:00Z",
+		"updated_since=2024-08-01T00:00:00.5Z",
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*len(queries))
+	for range 3 {
+		for _, query := range queries {
+			opts := optionsFromQuery(t, query)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data, err := g.GetFeed(context.Background(), opts)
+				if err == nil && len(data.Content) == 0 {
+					err = errors.New("empty feed")
+				}
+				errs <- err
+			}()
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(c.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("GetFeed() error = %v", err)
+		}
+	}
+}
+
+// TestGetFeedJoinsFetchOfEvictedEntry requests a feed while a fetch started
+// for an entry that has since been evicted is still in flight.
+func TestGetFeedJoinsFetchOfEvictedEntry(t *testing.T) {
+	c := newSlowCatalog()
+	g := newTestGenerator(c)
+	opts := optionsFromQuery(t, "updated_since=2024-08-01")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := g.GetFeed(ctx, opts)
+		first <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetFeed() error = %v, want %v", err, context.Canceled)
+	}
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := g.GetFeed(context.Background(), opts)
+		second <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(c.release)
+	if err := <-second; err != nil {
+		t.Fatalf("GetFeed() error = %v", err)
+	}
+	if syncs := c.syncs.Load(); syncs != 1 {
+		t.Errorf("catalog synced %d times, want 1", syncs)
+	}
+}
+
+// TestGetModFeedModfilesError requests the release feed of a mod whose
+// releases cannot be fetched, which must fail rather than look up to date.
+func TestGetModFeedModfilesError(t *testing.T) {
+	c := newSlowCatalog()
+	close(c.release)
+	g := newTestGenerator(c)
+	if _, err := g.GetModFeed(context.Background(), "one", GeneratorOptions{}); err == nil {
+		t.Error("GetModFeed() error = nil, want the fetch error")
+	}
+}
+
+// TestGetFeedKeepsWatchedOptions requests a watched feed with a longer fetch
+// interval, which must not change how the shared feed is refreshed.
+func TestGetFeedKeepsWatchedOptions(t *testing.T) {
+	c := newSlowCatalog()
+	close(c.release)
+	g := newTestGenerator(c)
+	g.Watch(context.Background(), GeneratorOptions{})
+	if _, err := g.GetFeed(context.Background(), optionsFromQuery(t, "fetch_interval=10000h")); err != nil {
+		t.Fatalf("GetFeed() error = %v", err)
+	}
+	gen := g.(*generator)
+	gen.cachedDataMux.RLock()
+	defer gen.cachedDataMux.RUnlock()
+	if len(gen.cachedData) != 1 {
+		t.Fatalf("got %d cached feeds, want 1", len(gen.cachedData))
+	}
+	for _, entry := range gen.cachedData {
+		if entry.opts.FetchInterval != time.Minute {
+			t.Errorf("FetchInterval = %v, want %v", entry.opts.FetchInterval, time.Minute)
+		}
+	}
+}
+
+// TestGetFeedExpiresOnEntryInterval requests a feed with a longer fetch
+// interval than the one its entry is refreshed on, which must not extend
+// how long the response is fresh.
+func TestGetFeedExpiresOnEntryInterval(t *testing.T) {
+	c := newSlowCatalog()
+	close(c.release)
+	g := newTestGenerator(c)
+	if _, err := g.GetFeed(context.Background(), GeneratorOptions{}); err != nil {
+		t.Fatalf("GetFeed() error = %v", err)
+	}
+	data, err := g.GetFeed(context.Background(), optionsFromQuery(t, "fetch_interval=10000h"))
+	if err != nil {
+		t.Fatalf("GetFeed() error = %v", err)
+	}
+	if got := data.ExpiresAt.Sub(data.SyncedAt); got != time.Minute {
+		t.Errorf("feed expires %v after it was synced, want %v", got, time.Minute)
+	}
+}
+
+// TestGetFeedNewFromStaleCatalog requests a feed that has not been built yet
+// while the catalog has not been synced within the fetch interval.
+func TestGetFeedNewFromStaleCatalog(t *testing.T) {
+	c := newSlowCatalog()
+	c.syncedAt = time.Now().UTC().Add(-time.Hour)
+	g := newTestGenerator(c)
+	data, err := g.GetFeed(context.Background(), optionsFromQuery(t, "tags=Gameplay"))
+	if err != nil {
+		t.Fatalf("GetFeed() error = %v", err)
+	}
+	if !data.Stale {
+		t.Error("feed built from a catalog synced an hour ago is not stale")
+	}
+
+	c.syncedAt = time.Now().UTC()
+	data, err = g.GetFeed(context.Background(), optionsFromQuery(t, "tags=Classes"))
+	if err != nil {
+		t.Fatalf("GetFeed() error = %v", err)
+	}
+	if data.Stale {
+		t.Error("feed built from a freshly synced catalog is stale")
+	}
+}
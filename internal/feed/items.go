@@ -0,0 +1,215 @@
+package feed
+
+import (
+	"cmp"
+	"fmt"
+	"mime"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+	"github.com/tinyzimmer/bg3mods-feed/internal/store"
+)
+
+// modFeed is a feed of mods, along with the details of its items that
+// feeds.Item has no fields for, by item ID.
+type modFeed struct {
+	*feeds.Feed
+	details map[string]itemDetails
+}
+
+// itemDetails are the details of a feed item that feeds.Item has no fields
+// for. They are added to the item when the feed is rendered.
+type itemDetails struct {
+	// authorURL is the profile URL of the author of the mod.
+	authorURL string
+	// authorAvatar is the URL of the avatar of the author of the mod.
+	authorAvatar string
+	// categories are the names of the tags of the mod.
+	categories []string
+	// image is the logo of the mod.
+	image *feeds.Enclosure
+}
+
+func newModFeed(feed *feeds.Feed) *modFeed {
+	return &modFeed{
+		Feed:    feed,
+		details: make(map[string]itemDetails),
+	}
+}
+
+func buildFeed(opts GeneratorOptions, records []*store.ModRecord) *modFeed {
+	feed := newModFeed(&feeds.Feed{
+		Title:       "BG3 Mods Feed",
+		Link:        &feeds.Link{Href: ""},
+		Description: "A feed of the latest mods for Baldur's Gate 3",
+	})
+	if opts.Author != "" && len(records) > 0 {
+		author := records[0].Mod.SubmittedBy
+		feed.Title = "BG3 Mods by " + author.Username
+		feed.Link = &feeds.Link{Href: author.ProfileURL}
+		feed.Description = "A feed of the latest mods for Baldur's Gate 3 by " + author.Username
+		feed.Image = &feeds.Image{
+			Url:   author.Avatar.Thumb100x100,
+			Title: author.Username,
+			Link:  author.ProfileURL,
+		}
+	}
+	if opts.Title != "" {
+		feed.Title = opts.Title
+	}
+	if opts.Description != "" {
+		feed.Description = opts.Description
+	}
+	if opts.Mode == config.ModeUpdates {
+		feed.Items = feed.updateItems(records)
+		if opts.MaxItems > 0 && len(feed.Items) > opts.MaxItems {
+			feed.Items = feed.Items[:opts.MaxItems]
+		}
+		return feed
+	}
+	for _, record := range records {
+		mod := record.Mod
+		feed.add(&feeds.Item{
+			Id:          mod.NameID,
+			Title:       mod.Name,
+			Link:        &feeds.Link{Href: mod.ProfileURL},
+			Author:      modAuthor(mod),
+			Description: mod.Summary,
+			Created:     mod.DateAdded(),
+			Updated:     mod.DateUpdated(),
+			Content:     mod.Description,
+			Enclosure:   modfileDownload(mod.Modfile),
+		}, mod)
+	}
+	return feed
+}
+
+func buildModFeed(opts GeneratorOptions, records []*store.ModRecord) *modFeed {
+	feed := newModFeed(&feeds.Feed{})
+	if len(records) == 0 {
+		return feed
+	}
+	mod := records[0].Mod
+	feed.Title = mod.Name + " Releases"
+	feed.Link = &feeds.Link{Href: mod.ProfileURL}
+	feed.Description = mod.Summary
+	feed.Items = feed.updateItems(records)
+	if opts.MaxItems > 0 && len(feed.Items) > opts.MaxItems {
+		feed.Items = feed.Items[:opts.MaxItems]
+	}
+	return feed
+}
+
+// add appends an item for the given mod to the feed, and records the details
+// of the mod for the item.
+func (f *modFeed) add(item *feeds.Item, mod mods.Mod) {
+	f.Items = append(f.Items, item)
+	f.details[item.Id] = modDetails(mod)
+}
+
+// updateItems returns one item for every recorded modfile of the given mods,
+// newest first, and records the details of the mods for the items.
+func (f *modFeed) updateItems(records []*store.ModRecord) []*feeds.Item {
+	var items []*feeds.Item
+	for _, record := range records {
+		mod := record.Mod
+		details := modDetails(mod)
+		for _, release := range record.Modfiles {
+			modfile := release.Modfile
+			added := time.Unix(int64(modfile.DateAdded), 0)
+			if modfile.DateAdded == 0 {
+				added = release.SeenAt
+			}
+			item := &feeds.Item{
+				// A modfile re-released under a new version is a new release
+				Id:          fmt.Sprintf("%s@%d@%s", mod.NameID, modfile.ID, modfile.Version),
+				Title:       strings.TrimSpace(mod.Name + " " + modfile.Version),
+				Link:        &feeds.Link{Href: mod.ProfileURL},
+				Author:      modAuthor(mod),
+				Description: describeModfile(modfile),
+				Created:     added,
+				Updated:     added,
+				Content:     modfile.Changelog,
+				Enclosure:   modfileDownload(modfile),
+			}
+			items = append(items, item)
+			f.details[item.Id] = details
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Created.After(items[j].Created)
+	})
+	return items
+}
+
+// modAuthor returns the author of a mod, if it is known.
+func modAuthor(mod mods.Mod) *feeds.Author {
+	if mod.SubmittedBy.Username == "" {
+		return nil
+	}
+	return &feeds.Author{Name: mod.SubmittedBy.Username}
+}
+
+// modDetails returns the details of the items for a mod.
+func modDetails(mod mods.Mod) itemDetails {
+	details := itemDetails{
+		authorURL:    mod.SubmittedBy.ProfileURL,
+		authorAvatar: mod.SubmittedBy.Avatar.Thumb100x100,
+	}
+	for _, tag := range mod.Tags {
+		details.categories = append(details.categories, tag.Name)
+	}
+	logo := cmp.Or(mod.Logo.Thumb320x180, mod.Logo.Original)
+	if logo != "" {
+		details.image = &feeds.Enclosure{
+			Url:  logo,
+			Type: mime.TypeByExtension(path.Ext(cmp.Or(mod.Logo.Filename, logo))),
+		}
+	}
+	return details
+}
+
+// modfileDownload returns the download of a modfile as an enclosure, if it
+// has one. Modfiles are always zip archives.
+func modfileDownload(modfile mods.Modfile) *feeds.Enclosure {
+	if modfile.Download.BinaryURL == "" {
+		return nil
+	}
+	return &feeds.Enclosure{
+		Url:    modfile.Download.BinaryURL,
+		Length: strconv.FormatUint(modfile.Filesize, 10),
+		Type:   "application/zip",
+	}
+}
+
+// describeModfile returns a short summary of the given modfile's details.
+func describeModfile(modfile mods.Modfile) string {
+	details := []string{formatFilesize(modfile.Filesize)}
+	if modfile.Version != "" {
+		details = append([]string{"Version " + modfile.Version}, details...)
+	}
+	if modfile.Filehash.MD5 != "" {
+		details = append(details, "MD5 "+modfile.Filehash.MD5)
+	}
+	return strings.Join(details, " | ")
+}
+
+func formatFilesize(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
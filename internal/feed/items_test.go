@@ -0,0 +1,29 @@
+package feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/feeds"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+	"github.com/tinyzimmer/bg3mods-feed/internal/store"
+)
+
+func TestUpdateItemsNewVersionOfModfile(t *testing.T) {
+	seen := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+	feed := newModFeed(&feeds.Feed{})
+	items := feed.updateItems([]*store.ModRecord{{
+		Mod: mods.Mod{ID: 1, NameID: "one", Name: "One"},
+		Modfiles: []store.ModfileRecord{
+			{Modfile: mods.Modfile{ID: 5, Version: "1.0"}, SeenAt: seen},
+			{Modfile: mods.Modfile{ID: 5, Version: "1.1"}, SeenAt: seen.Add(time.Hour)},
+		},
+	}})
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2", len(items))
+	}
+	if items[0].Id == items[1].Id {
+		t.Errorf("both releases have the ID %q", items[0].Id)
+	}
+}
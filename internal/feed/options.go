@@ -1,44 +1,127 @@
 package feed
 
 import (
+	"fmt"
+	"maps"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
 )
 
 // GeneratorOptions are the options for generating a feed.
 type GeneratorOptions struct {
+	// Title is the title of the feed.
+	Title string
+	// Description is the description of the feed.
+	Description string
 	// MaxItems is the maximum number of items to include in the feed.
 	MaxItems int
 	// Sort is the field to sort the feed by.
 	Sort string
 	// Tags are the tags to filter the feed by.
 	Tags []string
-	// Platform is the platform to filter the feed by.
-	Platform config.Platform
+	// TagsMatch is whether mods must have any or all of the Tags.
+	TagsMatch config.MatchMode
+	// TagsNot are the tags to exclude from the feed.
+	TagsNot []string
+	// Search is text that mods in the feed must mention.
+	Search string
+	// Thresholds are the minimum and maximum mod statistics to filter the feed by.
+	Thresholds config.Thresholds
+	// Dates are the bounds on when mods in the feed were added and updated.
+	Dates config.DateWindow
+	// Platforms are the platforms to filter the feed by.
+	Platforms []config.Platform
+	// PlatformMatch is whether mods must support any or all of the Platforms.
+	PlatformMatch config.MatchMode
+	// Author is the name ID of the user to filter the feed by.
+	Author string
 	// FetchInterval is the interval to fetch mods at.
 	FetchInterval time.Duration
 	// Format is the format to render the feed in.
 	Format config.FeedFormat
+	// Mode is what each item in the feed represents.
+	Mode config.FeedMode
+}
+
+// OptionsFromConfig converts the options for a feed in the configuration
+// into a GeneratorOptions struct.
+func OptionsFromConfig(c config.FeedConfig) GeneratorOptions {
+	return GeneratorOptions{
+		MaxItems:      c.MaxFeedItems,
+		Sort:          c.Sort,
+		Tags:          c.Tags,
+		TagsMatch:     c.TagsMatch,
+		TagsNot:       c.TagsNot,
+		Search:        c.Search,
+		Thresholds:    c.Thresholds,
+		Dates:         c.DateWindow,
+		Platforms:     c.Platforms,
+		PlatformMatch: c.PlatformMatch,
+		Format:        c.Format,
+		Mode:          c.Mode,
+	}
 }
 
 // OptionsFromQuery parses the query parameters from a URL into a GeneratorOptions struct.
-func OptionsFromQuery(u *url.URL) GeneratorOptions {
+// An error is returned if the sort, tag or platform options, the thresholds or
+// the date bounds contain invalid values.
+func OptionsFromQuery(u *url.URL) (GeneratorOptions, error) {
 	opts := GeneratorOptions{}
 	if maxItems, err := strconv.Atoi(u.Query().Get("max_items")); err == nil {
 		opts.MaxItems = maxItems
 	}
 	if sort := u.Query().Get("sort"); sort != "" {
 		opts.Sort = sort
+		if !mods.CanSort(opts.GetSort()) {
+			return opts, fmt.Errorf("invalid sort %q", sort)
+		}
 	}
 	if tags := u.Query().Get("tags"); tags != "" {
 		opts.Tags = strings.Split(tags, ",")
 	}
-	if platform := config.Platform(u.Query().Get("platform")); platform.IsValid() {
-		opts.Platform = platform
+	if tagsMatch := config.MatchMode(u.Query().Get("tags_match")); tagsMatch != "" {
+		if !tagsMatch.IsValid() {
+			return opts, fmt.Errorf("invalid tags_match %q (valid values: any, all)", tagsMatch)
+		}
+		opts.TagsMatch = tagsMatch
+	}
+	if tagsNot := u.Query().Get("tags_not"); tagsNot != "" {
+		opts.TagsNot = strings.Split(tagsNot, ",")
+	}
+	if platform := u.Query().Get("platform"); platform != "" {
+		platforms, err := config.ParsePlatforms(strings.Split(platform, ","))
+		if err != nil {
+			return opts, err
+		}
+		opts.Platforms = platforms
+	}
+	if platformMatch := config.MatchMode(u.Query().Get("platform_match")); platformMatch != "" {
+		if !platformMatch.IsValid() {
+			return opts, fmt.Errorf("invalid platform_match %q (valid values: any, all)", platformMatch)
+		}
+		opts.PlatformMatch = platformMatch
+	}
+	if search := strings.TrimSpace(u.Query().Get("q")); search != "" {
+		opts.Search = search
+	}
+	thresholds, err := thresholdsFromQuery(u.Query())
+	if err != nil {
+		return opts, err
+	}
+	opts.Thresholds = thresholds
+	dates, err := datesFromQuery(u.Query())
+	if err != nil {
+		return opts, err
+	}
+	opts.Dates = dates
+	if author := u.Query().Get("author"); author != "" {
+		opts.Author = author
 	}
 	if fetchInterval, err := time.ParseDuration(u.Query().Get("fetch_interval")); err == nil {
 		opts.FetchInterval = fetchInterval
@@ -46,36 +129,141 @@ func OptionsFromQuery(u *url.URL) GeneratorOptions {
 	if format := config.FeedFormat(u.Query().Get("format")); format.IsValid() {
 		opts.Format = format
 	}
-	return opts
+	if mode := config.FeedMode(u.Query().Get("mode")); mode.IsValid() {
+		opts.Mode = mode
+	}
+	return opts, nil
+}
+
+// thresholdsFromQuery parses the statistics thresholds from query
+// parameters. An error is returned for the first parameter that is set to
+// an invalid value.
+func thresholdsFromQuery(q url.Values) (config.Thresholds, error) {
+	var t config.Thresholds
+	ints := map[string]*int{
+		"min_downloads":   &t.MinDownloads,
+		"max_downloads":   &t.MaxDownloads,
+		"min_subscribers": &t.MinSubscribers,
+		"max_subscribers": &t.MaxSubscribers,
+	}
+	for _, name := range slices.Sorted(maps.Keys(ints)) {
+		if raw := q.Get(name); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				return t, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*ints[name] = value
+		}
+	}
+	floats := map[string]*float64{
+		"min_rating":   &t.MinRating,
+		"max_rating":   &t.MaxRating,
+		"min_positive": &t.MinPositive,
+		"max_positive": &t.MaxPositive,
+	}
+	for _, name := range slices.Sorted(maps.Keys(floats)) {
+		if raw := q.Get(name); raw != "" {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return t, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*floats[name] = value
+		}
+	}
+	sizes := map[string]*config.ByteSize{
+		"min_filesize": &t.MinFilesize,
+		"max_filesize": &t.MaxFilesize,
+	}
+	for _, name := range slices.Sorted(maps.Keys(sizes)) {
+		if raw := q.Get(name); raw != "" {
+			value, err := config.ParseByteSize(raw)
+			if err != nil {
+				return t, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*sizes[name] = value
+		}
+	}
+	return t, nil
+}
+
+// datesFromQuery parses the date bounds from query parameters. An error is
+// returned for the first parameter that is set to an invalid value.
+func datesFromQuery(q url.Values) (config.DateWindow, error) {
+	var w config.DateWindow
+	bounds := map[string]*config.TimeBound{
+		"added_since":    &w.AddedSince,
+		"added_before":   &w.AddedBefore,
+		"updated_since":  &w.UpdatedSince,
+		"updated_before": &w.UpdatedBefore,
+	}
+	for _, name := range slices.Sorted(maps.Keys(bounds)) {
+		if raw := q.Get(name); raw != "" {
+			value, err := config.ParseTimeBound(raw)
+			if err != nil {
+				return w, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*bounds[name] = value
+		}
+	}
+	return w, nil
 }
 
 // Merge merges the given GeneratorOptions into the current options and returns
 // a new copy.
 func (g GeneratorOptions) Merge(overrides GeneratorOptions) GeneratorOptions {
+	if overrides.Title != "" {
+		g.Title = overrides.Title
+	}
+	if overrides.Description != "" {
+		g.Description = overrides.Description
+	}
 	if overrides.MaxItems > 0 {
 		g.MaxItems = overrides.MaxItems
 	}
 	if overrides.Sort != "" {
 		g.Sort = overrides.Sort
 	}
-	if overrides.Platform != "" {
-		g.Platform = overrides.Platform
+	if len(overrides.Platforms) > 0 {
+		g.Platforms = overrides.Platforms
+	}
+	if overrides.PlatformMatch.IsValid() {
+		g.PlatformMatch = overrides.PlatformMatch
+	}
+	if overrides.Search != "" {
+		g.Search = overrides.Search
+	}
+	g.Thresholds = g.Thresholds.Merge(overrides.Thresholds)
+	g.Dates = g.Dates.Merge(overrides.Dates)
+	if overrides.Author != "" {
+		g.Author = overrides.Author
 	}
 	if len(overrides.Tags) > 0 {
 		g.Tags = overrides.Tags
 	}
+	if overrides.TagsMatch.IsValid() {
+		g.TagsMatch = overrides.TagsMatch
+	}
+	if len(overrides.TagsNot) > 0 {
+		g.TagsNot = overrides.TagsNot
+	}
 	if overrides.FetchInterval > 0 {
 		g.FetchInterval = overrides.FetchInterval
 	}
 	if overrides.Format.IsValid() {
 		g.Format = overrides.Format
 	}
+	if overrides.Mode.IsValid() {
+		g.Mode = overrides.Mode
+	}
 	return g
 }
 
 func (g GeneratorOptions) GetSort() string {
+	if g.Sort == "" && g.Mode == config.ModeUpdates {
+		return sortAliases[config.DefaultUpdatesSort]
+	}
 	if g.Sort == "" {
-		return sortAliases["recent"]
+		return sortAliases[config.DefaultSort]
 	}
 	if alias, ok := sortAliases[g.Sort]; ok {
 		return alias
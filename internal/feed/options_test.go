@@ -0,0 +1,69 @@
+package feed
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+)
+
+func TestOptionsFromQueryInvalid(t *testing.T) {
+	for _, query := range []string{
+		"max_filesize=50XB",
+		"min_downloads=many",
+		"min_rating=good",
+		"added_since=yesterday",
+		"updated_before=2024-13-01",
+		"tags_match=some",
+		"platform_match=some",
+	} {
+		u, err := url.Parse("/feed?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OptionsFromQuery(u); err == nil {
+			t.Errorf("OptionsFromQuery(%q) error = nil, want an error", query)
+		}
+	}
+}
+
+func TestOptionsFromQueryThresholds(t *testing.T) {
+	opts := optionsFromQuery(t, "max_filesize=50MB&min_downloads=10&min_rating=0.5")
+	if opts.Thresholds.MaxFilesize != 50_000_000 {
+		t.Errorf("MaxFilesize = %v, want 50MB", opts.Thresholds.MaxFilesize)
+	}
+	if opts.Thresholds.MinDownloads != 10 {
+		t.Errorf("MinDownloads = %d, want 10", opts.Thresholds.MinDownloads)
+	}
+	if opts.Thresholds.MinRating != 0.5 {
+		t.Errorf("MinRating = %v, want 0.5", opts.Thresholds.MinRating)
+	}
+}
+
+func TestOptionsFromQueryDates(t *testing.T) {
+	opts := optionsFromQuery(t, "added_since=7d&updated_before=2024-08-01")
+	if want := 7 * 24 * time.Hour; opts.Dates.AddedSince.Ago != want {
+		t.Errorf("AddedSince = %v, want %v ago", opts.Dates.AddedSince, want)
+	}
+	if want := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC); !opts.Dates.UpdatedBefore.At.Equal(want) {
+		t.Errorf("UpdatedBefore = %v, want %v", opts.Dates.UpdatedBefore, want)
+	}
+}
+
+func TestGetSortDefaultsByMode(t *testing.T) {
+	for _, tc := range []struct {
+		opts GeneratorOptions
+		want string
+	}{
+		{opts: GeneratorOptions{}, want: "-date_live"},
+		{opts: GeneratorOptions{Mode: config.ModeMods}, want: "-date_live"},
+		{opts: GeneratorOptions{Mode: config.ModeUpdates}, want: "-date_updated"},
+		{opts: GeneratorOptions{Mode: config.ModeUpdates, Sort: "popular"}, want: "-downloads_total"},
+		{opts: GeneratorOptions{Mode: config.ModeUpdates, Sort: "recent"}, want: "-date_live"},
+	} {
+		if got := tc.opts.GetSort(); got != tc.want {
+			t.Errorf("GetSort() with mode %q and sort %q = %q, want %q", tc.opts.Mode, tc.opts.Sort, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+
+	"github.com/gorilla/feeds"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+)
+
+// mediaNamespace is the namespace of the Media RSS elements used for images.
+const mediaNamespace = "http://search.yahoo.com/mrss/"
+
+// render renders the feed in the given format, including the details of its
+// items that feeds.Item has no fields for.
+func (f *modFeed) render(format config.FeedFormat) (string, error) {
+	switch format {
+	case config.FormatRSS:
+		return f.toRSS()
+	case config.FormatAtom:
+		return f.toAtom()
+	case config.FormatJSON:
+		return f.toJSON()
+	}
+	return "", fmt.Errorf("unsupported format %q", format)
+}
+
+type rssFeedXML struct {
+	XMLName          xml.Name    `xml:"rss"`
+	Version          string      `xml:"version,attr"`
+	ContentNamespace string      `xml:"xmlns:content,attr"`
+	MediaNamespace   string      `xml:"xmlns:media,attr"`
+	Channel          *rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	*feeds.RssFeed
+	Items []*rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	*feeds.RssItem
+	Categories []string `xml:"category"`
+	Thumbnail  *mediaThumbnail
+}
+
+type mediaThumbnail struct {
+	XMLName xml.Name `xml:"media:thumbnail"`
+	URL     string   `xml:"url,attr"`
+}
+
+// toRSS renders the feed as RSS 2.0. The download of an item is its
+// enclosure, and its image a Media RSS thumbnail.
+func (f *modFeed) toRSS() (string, error) {
+	rss := (&feeds.Rss{Feed: f.Feed}).RssFeed()
+	channel := &rssChannel{RssFeed: rss}
+	for i, item := range rss.Items {
+		details := f.details[f.Items[i].Id]
+		rich := &rssItem{RssItem: item, Categories: details.categories}
+		if details.image != nil {
+			rich.Thumbnail = &mediaThumbnail{URL: details.image.Url}
+		}
+		channel.Items = append(channel.Items, rich)
+	}
+	return toXML(&rssFeedXML{
+		Version:          "2.0",
+		ContentNamespace: "http://purl.org/rss/1.0/modules/content/",
+		MediaNamespace:   mediaNamespace,
+		Channel:          channel,
+	})
+}
+
+type atomFeed struct {
+	*feeds.AtomFeed
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	*feeds.AtomEntry
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// toAtom renders the feed as Atom. Both the download and the image of an
+// entry are enclosure links.
+func (f *modFeed) toAtom() (string, error) {
+	atom := (&feeds.Atom{Feed: f.Feed}).AtomFeed()
+	rich := &atomFeed{AtomFeed: atom}
+	for i, entry := range atom.Entries {
+		details := f.details[f.Items[i].Id]
+		if entry.Author != nil {
+			entry.Author.Uri = details.authorURL
+		}
+		if details.image != nil {
+			entry.Links = append(entry.Links, feeds.AtomLink{
+				Href: details.image.Url,
+				Rel:  "enclosure",
+				Type: details.image.Type,
+			})
+		}
+		richEntry := &atomEntry{AtomEntry: entry}
+		for _, category := range details.categories {
+			richEntry.Categories = append(richEntry.Categories, atomCategory{Term: category})
+		}
+		rich.Entries = append(rich.Entries, richEntry)
+	}
+	return toXML(rich)
+}
+
+type jsonFeed struct {
+	*feeds.JSONFeed
+	Items []*jsonItem `json:"items"`
+}
+
+type jsonItem struct {
+	*feeds.JSONItem
+	Attachments []jsonAttachment `json:"attachments,omitempty"`
+}
+
+// jsonAttachment is an attachment as the JSON Feed spec names its fields,
+// which feeds.JSONAttachment writes the size of as "size".
+type jsonAttachment struct {
+	URL      string `json:"url"`
+	MIMEType string `json:"mime_type"`
+	Size     uint64 `json:"size_in_bytes,omitempty"`
+}
+
+// toJSON renders the feed as a JSON Feed. The download of an item is its
+// attachment.
+func (f *modFeed) toJSON() (string, error) {
+	plain := (&feeds.JSON{Feed: f.Feed}).JSONFeed()
+	rich := &jsonFeed{JSONFeed: plain}
+	for i, item := range plain.Items {
+		details := f.details[f.Items[i].Id]
+		if item.Author != nil {
+			item.Author.Url = details.authorURL
+			item.Author.Avatar = details.authorAvatar
+		}
+		item.Tags = details.categories
+		item.Image = ""
+		if details.image != nil {
+			item.Image = details.image.Url
+		}
+		richItem := &jsonItem{JSONItem: item}
+		if download := f.Items[i].Enclosure; download != nil {
+			attachment := jsonAttachment{
+				URL:      download.Url,
+				MIMEType: download.Type,
+			}
+			// Sizes that are not known are left out
+			if size, err := strconv.ParseUint(download.Length, 10, 64); err == nil {
+				attachment.Size = size
+			}
+			richItem.Attachments = []jsonAttachment{attachment}
+		}
+		rich.Items = append(rich.Items, richItem)
+	}
+	data, err := json.MarshalIndent(rich, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// toXML marshals a feed as indented XML with a header, like feeds.ToXML.
+func toXML(feed any) (string, error) {
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	// Strip the newline from the default header
+	return xml.Header[:len(xml.Header)-1] + string(data), nil
+}
@@ -0,0 +1,177 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+	"github.com/tinyzimmer/bg3mods-feed/internal/store"
+)
+
+const (
+	testProfileURL = "https://mod.io/g/baldursgate3/u/someauthor"
+	testAvatarURL  = "https://thumb.modcdn.io/members/avatar.png"
+	testLogoURL    = "https://thumb.modcdn.io/mods/logo_320x180.png"
+	testFileURL    = "https://mod.io/v1/games/6715/mods/1/files/5/download"
+)
+
+// renderTestFeed renders a feed of a mod with every detail set.
+func renderTestFeed(t *testing.T, format config.FeedFormat) string {
+	t.Helper()
+	mod := mods.Mod{
+		ID:               1,
+		NameID:           "one",
+		Name:             "One",
+		Summary:          "The first mod",
+		ProfileURL:       "https://mod.io/g/baldursgate3/m/one",
+		DateAddedEpoch:   uint64(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC).Unix()),
+		DateUpdatedEpoch: uint64(time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC).Unix()),
+		SubmittedBy: mods.User{
+			Username:   "someauthor",
+			ProfileURL: testProfileURL,
+			Avatar:     mods.Avatar{Thumb100x100: testAvatarURL},
+		},
+		Logo: mods.Image{Filename: "logo.png", Thumb320x180: testLogoURL},
+		Tags: []mods.Tag{{Name: "Gameplay"}, {Name: "Classes"}},
+		Modfile: mods.Modfile{
+			ID:       5,
+			Filesize: 2048,
+			Download: mods.Download{BinaryURL: testFileURL},
+		},
+	}
+	data, err := buildFeed(GeneratorOptions{}, []*store.ModRecord{{Mod: mod}}).render(format)
+	if err != nil {
+		t.Fatalf("render(%s) error = %v", format, err)
+	}
+	return data
+}
+
+func TestRenderRSS(t *testing.T) {
+	var rss struct {
+		Channel struct {
+			Items []struct {
+				GUID       string   `xml:"guid"`
+				Author     string   `xml:"author"`
+				Categories []string `xml:"category"`
+				Enclosure  struct {
+					URL    string `xml:"url,attr"`
+					Length string `xml:"length,attr"`
+					Type   string `xml:"type,attr"`
+				} `xml:"enclosure"`
+				Thumbnail struct {
+					URL string `xml:"url,attr"`
+				} `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal([]byte(renderTestFeed(t, config.FormatRSS)), &rss); err != nil {
+		t.Fatalf("failed to parse RSS: %v", err)
+	}
+	if len(rss.Channel.Items) != 1 {
+		t.Fatalf("got %d items, want 1", len(rss.Channel.Items))
+	}
+	item := rss.Channel.Items[0]
+	if item.GUID != "one" || item.Author != "someauthor" {
+		t.Errorf("guid = %q and author = %q, want one and someauthor", item.GUID, item.Author)
+	}
+	if !slices.Equal(item.Categories, []string{"Gameplay", "Classes"}) {
+		t.Errorf("categories = %v, want [Gameplay Classes]", item.Categories)
+	}
+	if item.Enclosure.URL != testFileURL || item.Enclosure.Length != "2048" || item.Enclosure.Type != "application/zip" {
+		t.Errorf("enclosure = %+v, want the download", item.Enclosure)
+	}
+	if item.Thumbnail.URL != testLogoURL {
+		t.Errorf("media:thumbnail url = %q, want %q", item.Thumbnail.URL, testLogoURL)
+	}
+}
+
+func TestRenderAtom(t *testing.T) {
+	var atom struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Entries []struct {
+			Author struct {
+				Name string `xml:"name"`
+				URI  string `xml:"uri"`
+			} `xml:"author"`
+			Categories []struct {
+				Term string `xml:"term,attr"`
+			} `xml:"category"`
+			Links []struct {
+				Href   string `xml:"href,attr"`
+				Rel    string `xml:"rel,attr"`
+				Type   string `xml:"type,attr"`
+				Length string `xml:"length,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal([]byte(renderTestFeed(t, config.FormatAtom)), &atom); err != nil {
+		t.Fatalf("failed to parse Atom: %v", err)
+	}
+	if len(atom.Entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(atom.Entries))
+	}
+	entry := atom.Entries[0]
+	if entry.Author.Name != "someauthor" || entry.Author.URI != testProfileURL {
+		t.Errorf("author = %+v, want someauthor with their profile", entry.Author)
+	}
+	var terms []string
+	for _, category := range entry.Categories {
+		terms = append(terms, category.Term)
+	}
+	if !slices.Equal(terms, []string{"Gameplay", "Classes"}) {
+		t.Errorf("category terms = %v, want [Gameplay Classes]", terms)
+	}
+	enclosures := make(map[string]string)
+	for _, link := range entry.Links {
+		if link.Rel == "enclosure" {
+			enclosures[link.Href] = link.Type
+		}
+	}
+	if enclosures[testFileURL] != "application/zip" || enclosures[testLogoURL] != "image/png" {
+		t.Errorf("enclosure links = %v, want the download and the logo", enclosures)
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	var feed struct {
+		Items []struct {
+			ID     string `json:"id"`
+			Author struct {
+				Name   string `json:"name"`
+				URL    string `json:"url"`
+				Avatar string `json:"avatar"`
+			} `json:"author"`
+			Tags        []string `json:"tags"`
+			Image       string   `json:"image"`
+			Attachments []struct {
+				URL      string `json:"url"`
+				MIMEType string `json:"mime_type"`
+				Size     int    `json:"size_in_bytes"`
+			} `json:"attachments"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(renderTestFeed(t, config.FormatJSON)), &feed); err != nil {
+		t.Fatalf("failed to parse JSON feed: %v", err)
+	}
+	if len(feed.Items) != 1 {
+		t.Fatalf("got %d items, want 1", len(feed.Items))
+	}
+	item := feed.Items[0]
+	if item.Author.Name != "someauthor" || item.Author.URL != testProfileURL || item.Author.Avatar != testAvatarURL {
+		t.Errorf("author = %+v, want someauthor with their profile and avatar", item.Author)
+	}
+	if !slices.Equal(item.Tags, []string{"Gameplay", "Classes"}) {
+		t.Errorf("tags = %v, want [Gameplay Classes]", item.Tags)
+	}
+	if item.Image != testLogoURL {
+		t.Errorf("image = %q, want %q", item.Image, testLogoURL)
+	}
+	if len(item.Attachments) != 1 || item.Attachments[0].URL != testFileURL ||
+		item.Attachments[0].MIMEType != "application/zip" || item.Attachments[0].Size != 2048 {
+		t.Errorf("attachments = %+v, want the download", item.Attachments)
+	}
+}
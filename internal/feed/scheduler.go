@@ -0,0 +1,131 @@
+package feed
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRefreshCheckInterval is the longest time between checks for feeds
+	// that need to be refreshed.
+	maxRefreshCheckInterval = time.Minute
+	// idleFeedIntervals is the number of fetch intervals a feed that was not
+	// registered with Watch is kept up to date without being requested.
+	idleFeedIntervals = 12
+	// maxConcurrentRefreshes is the maximum number of feeds refreshed in
+	// the background at once.
+	maxConcurrentRefreshes = 4
+)
+
+func (g *generator) Watch(ctx context.Context, overrides GeneratorOptions) {
+	opts := g.defaults.Merge(overrides)
+	key := newCacheKey(opts)
+
+	entry, _ := g.entry(key, opts, g.feedSource())
+	entry.mu.Lock()
+	entry.opts = opts
+	entry.pinned = true
+	entry.mu.Unlock()
+}
+
+func (g *generator) Run(ctx context.Context) {
+	ticker := time.NewTicker(g.refreshCheckInterval())
+	defer ticker.Stop()
+	for {
+		g.syncCatalog(ctx)
+		g.refreshStale(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *generator) Status() Status {
+	status := Status{Status: g.catalog.Status()}
+	g.cachedDataMux.RLock()
+	defer g.cachedDataMux.RUnlock()
+	for _, entry := range g.cachedData {
+		entry.mu.RLock()
+		if entry.feed != nil {
+			status.Feeds++
+			if g.isStale(entry.at, entry.opts.FetchInterval) {
+				status.StaleFeeds++
+			}
+		}
+		entry.mu.RUnlock()
+	}
+	return status
+}
+
+// isStale returns true if a feed synced at the given time, and refreshed at
+// the given interval, should have been refreshed by Run by now.
+func (g *generator) isStale(at time.Time, interval time.Duration) bool {
+	return time.Since(at) >= interval+g.refreshCheckInterval()
+}
+
+// refreshCheckInterval returns the time between checks for feeds that need
+// to be refreshed.
+func (g *generator) refreshCheckInterval() time.Duration {
+	interval := g.defaults.FetchInterval
+	if interval <= 0 || interval > maxRefreshCheckInterval {
+		interval = maxRefreshCheckInterval
+	}
+	return interval
+}
+
+// syncCatalog syncs the catalog if it is older than the default fetch interval.
+func (g *generator) syncCatalog(ctx context.Context) {
+	if time.Since(g.catalog.SyncedAt()) < g.defaults.FetchInterval {
+		return
+	}
+	if err := g.catalog.Sync(ctx); err != nil {
+		slog.ErrorContext(ctx, "Failed to sync catalog", "error", err)
+	}
+}
+
+// refreshStale refreshes every cached feed older than its fetch interval, and
+// evicts feeds that have not been requested for a while. Up to
+// maxConcurrentRefreshes feeds are refreshed at once.
+func (g *generator) refreshStale(ctx context.Context) {
+	now := time.Now()
+	stale := make(map[cacheKey]*cachedFeed)
+	g.cachedDataMux.Lock()
+	for key, entry := range g.cachedData {
+		entry.mu.RLock()
+		idle := !entry.pinned && now.Sub(entry.requestedAt) > idleFeedIntervals*entry.opts.FetchInterval
+		expired := entry.feed == nil || now.Sub(entry.at) >= entry.opts.FetchInterval
+		entry.mu.RUnlock()
+		if idle {
+			slog.InfoContext(ctx, "Evicting idle feed", "key", key.String())
+			delete(g.cachedData, key)
+			continue
+		}
+		if expired {
+			stale[key] = entry
+		}
+	}
+	g.cachedDataMux.Unlock()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentRefreshes)
+	for key, entry := range stale {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				slog.DebugContext(ctx, "Refreshing feed", "key", key.String())
+				if err := g.refresh(ctx, key, entry); err != nil {
+					slog.WarnContext(ctx, "Failed to refresh feed", "key", key.String(), "error", err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "bg3mods"
+
+var (
+	// Requests counts the requests served, by route, feed format and status code.
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests served, by route, feed format and status code.",
+	}, []string{"route", "format", "code"})
+	// RequestDuration observes how long requests took to serve, by route and feed format.
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve requests, by route and feed format.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "format"})
+
+	// CacheLookups counts feed cache lookups, by the shape of the cache key
+	// (which options are set) and result (hit, stale or miss).
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "feed_cache_lookups_total",
+		Help:      "Feed cache lookups, by key shape and result (hit, stale, miss).",
+	}, []string{"shape", "result"})
+
+	// UpstreamRequests counts requests to the API, by endpoint and status code.
+	// The code is "error" for requests that failed without a response.
+	UpstreamRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_requests_total",
+		Help:      "Requests to the API, by endpoint and status code (error if there was no response).",
+	}, []string{"endpoint", "code"})
+	// UpstreamRequestDuration observes how long requests to the API took, by endpoint.
+	UpstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Time taken by requests to the API, by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+	// RateLimitWait observes how long requests to the API waited for the rate limiter.
+	RateLimitWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_rate_limit_wait_seconds",
+		Help:      "Time requests to the API waited for the rate limiter.",
+		Buckets:   []float64{0, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	})
+
+	// CatalogSyncs counts catalog syncs, by type (full or incremental) and
+	// result (success or failure).
+	CatalogSyncs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "catalog_syncs_total",
+		Help:      "Catalog syncs, by type (full, incremental) and result (success, failure).",
+	}, []string{"type", "result"})
+	// CatalogSyncPages observes the number of pages fetched per catalog sync, by type.
+	CatalogSyncPages = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "catalog_sync_pages",
+		Help:      "Pages fetched from the API per catalog sync, by type (full, incremental).",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 11),
+	}, []string{"type"})
+	// CatalogLastSync is the time the catalog was last synced successfully.
+	CatalogLastSync = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "catalog_last_sync_timestamp_seconds",
+		Help:      "Unix time the catalog was last synced successfully.",
+	})
+	// CatalogMods is the number of mods in the catalog.
+	CatalogMods = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "catalog_mods",
+		Help:      "Number of mods in the catalog.",
+	})
+)
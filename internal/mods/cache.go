@@ -0,0 +1,75 @@
+package mods
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cachedPage is a response from the API that can be revalidated with a
+// conditional request.
+type cachedPage struct {
+	url          string
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// pageCache holds the most recently used responses that had an ETag or
+// Last-Modified header, so unchanged pages do not have to be downloaded again.
+type pageCache struct {
+	maxPages int
+	maxBytes int
+
+	mu    sync.Mutex
+	pages map[string]*list.Element
+	// order holds the pages, most recently used first.
+	order *list.List
+	// size is the total size of the bodies of the pages.
+	size int
+}
+
+func newPageCache(maxPages, maxBytes int) *pageCache {
+	return &pageCache{
+		maxPages: maxPages,
+		maxBytes: maxBytes,
+		pages:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the cached response for the given URL, or nil if there is none.
+func (c *pageCache) get(url string) *cachedPage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.pages[url]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedPage)
+}
+
+// put caches a response, evicting the least recently used ones if the cache
+// is full. Responses larger than the whole cache are not cached.
+func (c *pageCache) put(page *cachedPage) {
+	if c.maxPages <= 0 || (c.maxBytes > 0 && len(page.body) > c.maxBytes) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.pages[page.url]; ok {
+		c.size -= len(elem.Value.(*cachedPage).body)
+		elem.Value = page
+		c.order.MoveToFront(elem)
+	} else {
+		c.pages[page.url] = c.order.PushFront(page)
+	}
+	c.size += len(page.body)
+	for c.order.Len() > c.maxPages || (c.maxBytes > 0 && c.size > c.maxBytes) {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		evicted := oldest.Value.(*cachedPage)
+		delete(c.pages, evicted.url)
+		c.size -= len(evicted.body)
+	}
+}
@@ -0,0 +1,97 @@
+package mods
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFetchRevalidatesCachedPage(t *testing.T) {
+	const etag = `"v1"`
+	var requests, notModified atomic.Int32
+	f := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(`{"data": [{"id": 1, "name_id": "one"}], "result_count": 1}`))
+	})
+	for range 2 {
+		res, err := f.Fetch(context.Background(), FetchOptions{Limit: 100})
+		if err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		if len(res.Data) != 1 || res.Data[0].NameID != "one" {
+			t.Fatalf("Fetch() = %+v, want the mod one", res.Data)
+		}
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+	if got := notModified.Load(); got != 1 {
+		t.Errorf("got %d revalidated requests, want 1", got)
+	}
+}
+
+func TestPageCacheEviction(t *testing.T) {
+	page := func(url string, size int) *cachedPage {
+		return &cachedPage{url: url, etag: `"x"`, body: []byte(strings.Repeat("x", size))}
+	}
+	for _, tc := range []struct {
+		name               string
+		maxPages, maxBytes int
+		pages              []*cachedPage
+		want               []string
+	}{
+		{
+			name:     "by count",
+			maxPages: 2,
+			pages:    []*cachedPage{page("a", 10), page("b", 10), page("c", 10)},
+			want:     []string{"b", "c"},
+		},
+		{
+			name:     "by size",
+			maxPages: 10, maxBytes: 25,
+			pages: []*cachedPage{page("a", 10), page("b", 10), page("c", 10)},
+			want:  []string{"b", "c"},
+		},
+		{
+			name:     "replaced page",
+			maxPages: 10, maxBytes: 25,
+			pages: []*cachedPage{page("a", 10), page("b", 10), page("a", 15)},
+			want:  []string{"a", "b"},
+		},
+		{
+			name:     "page larger than the cache",
+			maxPages: 10, maxBytes: 25,
+			pages: []*cachedPage{page("a", 10), page("b", 30)},
+			want:  []string{"a"},
+		},
+		{
+			name:  "disabled",
+			pages: []*cachedPage{page("a", 10)},
+		},
+	} {
+		c := newPageCache(tc.maxPages, tc.maxBytes)
+		for _, p := range tc.pages {
+			c.put(p)
+		}
+		var got []string
+		for _, url := range []string{"a", "b", "c"} {
+			if c.get(url) != nil {
+				got = append(got, url)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: cached pages = %v, want %v", tc.name, got, tc.want)
+		}
+		if tc.maxBytes > 0 && c.size > tc.maxBytes {
+			t.Errorf("%s: cached %d bytes, want at most %d", tc.name, c.size, tc.maxBytes)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package mods
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/metrics"
+	"github.com/tinyzimmer/bg3mods-feed/internal/tracing"
+)
+
+// tracer returns the tracer for API requests from the global tracer provider.
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/tinyzimmer/bg3mods-feed/internal/mods")
+}
+
+// FetcherOption is an option for configuring a Fetcher.
+type FetcherOption func(*fetcher)
+
+// WithHTTPClient sets the HTTP client used to make requests. Its timeout is
+// overridden by WithTimeout.
+func WithHTTPClient(client *http.Client) FetcherOption {
+	return func(f *fetcher) {
+		f.client = client
+	}
+}
+
+// WithTimeout sets the timeout for a single request to the API, including
+// reading the response. Zero means no timeout.
+func WithTimeout(timeout time.Duration) FetcherOption {
+	return func(f *fetcher) {
+		f.timeout = timeout
+	}
+}
+
+// WithMaxRetries sets the number of times requests that fail with a network
+// error, a rate limit or a server error are retried. Zero disables retries.
+func WithMaxRetries(retries int) FetcherOption {
+	return func(f *fetcher) {
+		f.maxRetries = retries
+	}
+}
+
+// WithBackoff sets the wait before the first retry of a request and the
+// longest wait between retries. The wait doubles after every retry, with
+// random jitter, unless the API says how long to wait.
+func WithBackoff(backoff, maxBackoff time.Duration) FetcherOption {
+	return func(f *fetcher) {
+		f.backoff = backoff
+		f.maxBackoff = maxBackoff
+	}
+}
+
+// WithRateLimiter makes every request wait for the given RateLimiter, which
+// can be shared with other fetchers.
+func WithRateLimiter(limiter *RateLimiter) FetcherOption {
+	return func(f *fetcher) {
+		f.limiter = limiter
+	}
+}
+
+// WithAPIKey authenticates requests with the given mod.io API key, for use
+// with the official mod.io API.
+func WithAPIKey(key string) FetcherOption {
+	return func(f *fetcher) {
+		f.apiKey = key
+	}
+}
+
+// WithAccessToken authenticates requests with the given mod.io OAuth access
+// token, for use with the official mod.io API.
+func WithAccessToken(token string) FetcherOption {
+	return func(f *fetcher) {
+		f.accessToken = token
+	}
+}
+
+// WithPageCache sets the number of responses kept to be revalidated with
+// conditional requests, so pages that have not changed since they were last
+// fetched are not downloaded again, and the most bytes their bodies can take
+// up. Zero pages disables the cache, and zero bytes means no size limit.
+func WithPageCache(maxPages, maxBytes int) FetcherOption {
+	return func(f *fetcher) {
+		f.pages = newPageCache(maxPages, maxBytes)
+	}
+}
+
+// rateLimit tracks when the API allows the next request.
+type rateLimit struct {
+	mu        sync.Mutex
+	notBefore time.Time
+}
+
+// wait blocks until the API allows the next request.
+func (r *rateLimit) wait(ctx context.Context) error {
+	r.mu.Lock()
+	wait := time.Until(r.notBefore)
+	r.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	slog.InfoContext(ctx, "Waiting for the API rate limit to reset", "wait", wait.Round(time.Millisecond))
+	return sleep(ctx, wait)
+}
+
+// delay pushes back the next request until at least the given time.
+func (r *rateLimit) delay(until time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if until.After(r.notBefore) {
+		r.notBefore = until
+	}
+}
+
+// get fetches the given URL and decodes the JSON response into out, retrying
+// failed requests. The endpoint names the kind of URL in metrics.
+func (f *fetcher) get(ctx context.Context, endpoint, url string, out any) error {
+	for attempt := 0; ; attempt++ {
+		if err := f.limit.wait(ctx); err != nil {
+			return err
+		}
+		if err := f.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		retry, retryAfter, err := f.do(ctx, endpoint, url, out)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= f.maxRetries || ctx.Err() != nil {
+			return err
+		}
+		wait := retryAfter
+		if wait <= 0 {
+			wait = f.backoffFor(attempt)
+		}
+		slog.WarnContext(ctx, "Retrying API request", "url", url, "attempt", attempt+1, "wait", wait.Round(time.Millisecond), "error", err)
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// do makes a single request. If it fails, do reports whether it can be
+// retried and how long the API asked to wait before doing so.
+func (f *fetcher) do(ctx context.Context, endpoint, url string, out any) (bool, time.Duration, error) {
+	ctx, span := tracer().Start(ctx, "GET "+endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", http.MethodGet),
+			attribute.String("url.full", url),
+		),
+	)
+	defer span.End()
+	retry, retryAfter, err := f.send(ctx, endpoint, url, out)
+	return retry, retryAfter, tracing.RecordError(span, err)
+}
+
+// send makes a single request, as described by do.
+func (f *fetcher) send(ctx context.Context, endpoint, url string, out any) (bool, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	f.authenticate(req)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	cached := f.pages.get(url)
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	start := time.Now()
+	resp, err := f.client.Do(req)
+	duration := time.Since(start)
+	metrics.UpstreamRequestDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+	if err != nil {
+		metrics.UpstreamRequests.WithLabelValues(endpoint, "error").Inc()
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			// Keep the API key out of logs
+			urlErr.URL = url
+		}
+		return true, 0, err
+	}
+	defer resp.Body.Close()
+	metrics.UpstreamRequests.WithLabelValues(endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	slog.DebugContext(ctx, "Fetched from API", "endpoint", endpoint, "url", url, "status", resp.StatusCode, "duration", duration)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return true, 0, fmt.Errorf("failed to read response: %w", err)
+	}
+	retryAfter := f.checkRateLimit(resp)
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		slog.DebugContext(ctx, "Reusing unchanged response", "url", url)
+		body = cached.body
+	} else if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body)
+		switch resp.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests,
+			http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true, retryAfter, err
+		}
+		return false, 0, err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return false, 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if resp.StatusCode == http.StatusOK && (etag != "" || lastModified != "") {
+		f.pages.put(&cachedPage{
+			url:          url,
+			etag:         etag,
+			lastModified: lastModified,
+			body:         body,
+		})
+	}
+	return false, 0, nil
+}
+
+// authenticate adds the credentials of the fetcher to a request. Requests
+// without credentials are made as the mod.io website, which is what the
+// unauthenticated embed API expects.
+func (f *fetcher) authenticate(req *http.Request) {
+	if f.apiKey == "" && f.accessToken == "" {
+		req.Header.Set("X-Modio-Origin", "web")
+		return
+	}
+	if f.apiKey != "" {
+		q := req.URL.Query()
+		q.Set("api_key", f.apiKey)
+		req.URL.RawQuery = q.Encode()
+	}
+	if f.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+f.accessToken)
+	}
+}
+
+// checkRateLimit returns how long the API asked to wait before the next
+// request, from the Retry-After or X-RateLimit-* headers of a response. If
+// the rate limit is exhausted, the next request is delayed until it resets.
+func (f *fetcher) checkRateLimit(resp *http.Response) time.Duration {
+	var wait time.Duration
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(value); err == nil {
+			wait = time.Until(at)
+		}
+	}
+	if wait <= 0 {
+		if seconds, err := strconv.Atoi(resp.Header.Get("X-RateLimit-RetryAfter")); err == nil {
+			wait = time.Duration(seconds) * time.Second
+		} else if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			// The reset is either a Unix time or a number of seconds
+			if reset > 1e9 {
+				wait = time.Until(time.Unix(reset, 0))
+			} else {
+				wait = time.Duration(reset) * time.Second
+			}
+		}
+	}
+	if wait <= 0 {
+		return 0
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		f.limit.delay(time.Now().Add(wait))
+	}
+	return wait
+}
+
+// backoffFor returns the wait before the retry after the given attempt.
+func (f *fetcher) backoffFor(attempt int) time.Duration {
+	wait := f.backoff
+	for i := 0; i < attempt && wait < f.maxBackoff; i++ {
+		wait *= 2
+	}
+	if f.maxBackoff > 0 {
+		wait = min(wait, f.maxBackoff)
+	}
+	if wait <= 0 {
+		return 0
+	}
+	// Wait between half and all of the backoff, so concurrent retries spread out
+	return wait/2 + rand.N(wait/2+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
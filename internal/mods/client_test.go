@@ -0,0 +1,152 @@
+package mods
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestFetcher(t *testing.T, handler http.HandlerFunc, opts ...FetcherOption) *fetcher {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	opts = append([]FetcherOption{WithBackoff(time.Millisecond, time.Millisecond)}, opts...)
+	return NewFetcher(srv.URL, opts...).(*fetcher)
+}
+
+func TestCheckRateLimit(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		name    string
+		status  int
+		headers map[string]string
+		// The wait is truncated to whole seconds when given as a time
+		wantMin, wantMax time.Duration
+		delayed          bool
+	}{
+		{name: "no headers", status: http.StatusOK},
+		{
+			name:    "retry after seconds",
+			status:  http.StatusTooManyRequests,
+			headers: map[string]string{"Retry-After": "3"},
+			wantMin: 3 * time.Second, wantMax: 3 * time.Second,
+			delayed: true,
+		},
+		{
+			name:    "retry after date",
+			status:  http.StatusServiceUnavailable,
+			headers: map[string]string{"Retry-After": now.Add(10 * time.Second).UTC().Format(http.TimeFormat)},
+			wantMin: 8 * time.Second, wantMax: 10 * time.Second,
+		},
+		{
+			name:    "retry after date in the past",
+			status:  http.StatusServiceUnavailable,
+			headers: map[string]string{"Retry-After": now.Add(-time.Minute).UTC().Format(http.TimeFormat)},
+		},
+		{
+			name:    "rate limit retry after",
+			status:  http.StatusTooManyRequests,
+			headers: map[string]string{"X-RateLimit-RetryAfter": "5"},
+			wantMin: 5 * time.Second, wantMax: 5 * time.Second,
+			delayed: true,
+		},
+		{
+			name:    "exhausted rate limit reset in seconds",
+			status:  http.StatusOK,
+			headers: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "60"},
+			wantMin: time.Minute, wantMax: time.Minute,
+			delayed: true,
+		},
+		{
+			name:    "exhausted rate limit reset at a time",
+			status:  http.StatusOK,
+			headers: map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(now.Add(30*time.Second).Unix(), 10)},
+			wantMin: 28 * time.Second, wantMax: 30 * time.Second,
+			delayed: true,
+		},
+		{
+			name:    "remaining rate limit",
+			status:  http.StatusOK,
+			headers: map[string]string{"X-RateLimit-Remaining": "10", "X-RateLimit-Reset": "60"},
+			wantMin: time.Minute, wantMax: time.Minute,
+		},
+		{
+			name:    "retry after takes precedence",
+			status:  http.StatusTooManyRequests,
+			headers: map[string]string{"Retry-After": "2", "X-RateLimit-RetryAfter": "5"},
+			wantMin: 2 * time.Second, wantMax: 2 * time.Second,
+			delayed: true,
+		},
+	} {
+		f := NewFetcher("").(*fetcher)
+		resp := &http.Response{StatusCode: tc.status, Header: make(http.Header)}
+		for key, value := range tc.headers {
+			resp.Header.Set(key, value)
+		}
+		wait := f.checkRateLimit(resp)
+		if wait < tc.wantMin || wait > tc.wantMax {
+			t.Errorf("%s: checkRateLimit() = %v, want between %v and %v", tc.name, wait, tc.wantMin, tc.wantMax)
+		}
+		if delayed := !f.limit.notBefore.IsZero(); delayed != tc.delayed {
+			t.Errorf("%s: next request delayed = %v, want %v", tc.name, delayed, tc.delayed)
+		}
+	}
+}
+
+func TestBackoffFor(t *testing.T) {
+	f := NewFetcher("", WithBackoff(time.Second, 4*time.Second)).(*fetcher)
+	for _, tc := range []struct {
+		attempt          int
+		wantMin, wantMax time.Duration
+	}{
+		{attempt: 0, wantMin: 500 * time.Millisecond, wantMax: time.Second},
+		{attempt: 1, wantMin: time.Second, wantMax: 2 * time.Second},
+		{attempt: 2, wantMin: 2 * time.Second, wantMax: 4 * time.Second},
+		{attempt: 10, wantMin: 2 * time.Second, wantMax: 4 * time.Second},
+		{attempt: 100, wantMin: 2 * time.Second, wantMax: 4 * time.Second},
+	} {
+		for range 20 {
+			if wait := f.backoffFor(tc.attempt); wait < tc.wantMin || wait > tc.wantMax {
+				t.Fatalf("backoffFor(%d) = %v, want between %v and %v", tc.attempt, wait, tc.wantMin, tc.wantMax)
+			}
+		}
+	}
+	if wait := NewFetcher("", WithBackoff(0, 0)).(*fetcher).backoffFor(3); wait != 0 {
+		t.Errorf("backoffFor() without a backoff = %v, want 0", wait)
+	}
+}
+
+func TestFetchRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		statuses     []int
+		wantRequests int32
+		wantErr      bool
+	}{
+		{name: "success", statuses: []int{http.StatusOK}, wantRequests: 1},
+		{name: "recovers", statuses: []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, wantRequests: 3},
+		{name: "gives up", statuses: []int{http.StatusServiceUnavailable}, wantRequests: 3, wantErr: true},
+		{name: "not retryable", statuses: []int{http.StatusNotFound}, wantRequests: 1, wantErr: true},
+	} {
+		var requests atomic.Int32
+		f := newTestFetcher(t, func(w http.ResponseWriter, r *http.Request) {
+			n := int(requests.Add(1))
+			status := tc.statuses[min(n, len(tc.statuses))-1]
+			w.WriteHeader(status)
+			if status == http.StatusOK {
+				w.Write([]byte(`{"data": []}`))
+			}
+		}, WithMaxRetries(2))
+		_, err := f.Fetch(context.Background(), FetchOptions{})
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: Fetch() error = %v, want error %v", tc.name, err, tc.wantErr)
+		}
+		if got := requests.Load(); got != tc.wantRequests {
+			t.Errorf("%s: got %d requests, want %d", tc.name, got, tc.wantRequests)
+		}
+	}
+}
@@ -2,14 +2,18 @@ package mods
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+	"github.com/tinyzimmer/bg3mods-feed/internal/tracing"
 )
 
 // FetchOptions are the options for fetching mods from the API.
@@ -17,57 +21,105 @@ type FetchOptions struct {
 	Limit  int
 	Offset int
 	Sort   string
-	Tags   []string
+	NameID string
+
+	DateUpdatedMin time.Time
 }
 
 // Fetcher is the interface for fetching mods from the API.
 type Fetcher interface {
 	// Fetch fetches mods from the API based on the given options.
 	Fetch(context.Context, FetchOptions) (*GetModsResponse, error)
+	// FetchModfiles fetches the modfiles (releases) of the mod with the given ID.
+	// Only the limit, offset and sort options are used.
+	FetchModfiles(context.Context, int, FetchOptions) (*GetModfilesResponse, error)
 }
 
 type fetcher struct {
-	apiURL string
+	apiURL     string
+	client     *http.Client
+	timeout    time.Duration
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	limit      rateLimit
+	limiter    *RateLimiter
+	pages      *pageCache
+
+	apiKey      string
+	accessToken string
 }
 
-// NewFetcher creates a new Fetcher using the given API URL.
-func NewFetcher(apiURL string) Fetcher {
-	return &fetcher{apiURL}
+// NewFetcher creates a new Fetcher using the given API URL and options. An
+// empty URL and options that are not given fall back to the defaults of the
+// configuration.
+func NewFetcher(apiURL string, opts ...FetcherOption) Fetcher {
+	if apiURL == "" {
+		apiURL = config.DefaultAPIURL
+	}
+	f := &fetcher{
+		apiURL:     apiURL,
+		client:     http.DefaultClient,
+		timeout:    config.DefaultHTTPTimeout,
+		maxRetries: config.DefaultMaxRetries,
+		backoff:    config.DefaultRetryBackoff,
+		maxBackoff: config.DefaultMaxRetryBackoff,
+		limiter:    NewRateLimiter(0, 1),
+		pages:      newPageCache(config.DefaultPageCacheSize, int(config.DefaultPageCacheMaxSize)),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	client := *f.client
+	client.Timeout = f.timeout
+	f.client = &client
+	return f
 }
 
 func (f *fetcher) Fetch(ctx context.Context, opts FetchOptions) (*GetModsResponse, error) {
-	url, err := f.optsToURL(opts)
+	ctx, span := tracer().Start(ctx, "mods.Fetch", trace.WithAttributes(
+		attribute.Int("mods.limit", opts.Limit),
+		attribute.Int("mods.offset", opts.Offset),
+		attribute.String("mods.sort", opts.Sort),
+	))
+	defer span.End()
+	url, err := f.optsToURL(f.apiURL, opts)
 	if err != nil {
-		return nil, err
+		return nil, tracing.RecordError(span, err)
 	}
-	log.Println("Fetching mods from", url)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
+	var modResp GetModsResponse
+	if err := f.get(ctx, "mods", url, &modResp); err != nil {
+		return nil, tracing.RecordError(span, err)
 	}
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("X-Modio-Origin", "web")
-	resp, err := http.DefaultClient.Do(req)
+	span.SetAttributes(attribute.Int("mods.count", len(modResp.Data)))
+	return &modResp, nil
+}
+
+func (f *fetcher) FetchModfiles(ctx context.Context, modID int, opts FetchOptions) (*GetModfilesResponse, error) {
+	ctx, span := tracer().Start(ctx, "mods.FetchModfiles", trace.WithAttributes(
+		attribute.Int("mods.id", modID),
+		attribute.Int("mods.limit", opts.Limit),
+		attribute.Int("mods.offset", opts.Offset),
+	))
+	defer span.End()
+	url, err := f.optsToURL(fmt.Sprintf("%s/%d/files", strings.TrimSuffix(f.apiURL, "/"), modID), FetchOptions{
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+		Sort:   opts.Sort,
+	})
 	if err != nil {
-		return nil, err
+		return nil, tracing.RecordError(span, err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, body)
+	var filesResp GetModfilesResponse
+	if err := f.get(ctx, "modfiles", url, &filesResp); err != nil {
+		return nil, tracing.RecordError(span, err)
 	}
-	var modResp GetModsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&modResp); err != nil {
-		return nil, err
-	}
-	return &modResp, nil
+	span.SetAttributes(attribute.Int("mods.count", len(filesResp.Data)))
+	return &filesResp, nil
 }
 
-func (f *fetcher) optsToURL(opts FetchOptions) (string, error) {
-	u, err := url.Parse(f.apiURL)
+func (f *fetcher) optsToURL(apiURL string, opts FetchOptions) (string, error) {
+	u, err := url.Parse(apiURL)
 	if err != nil {
 		return "", err
 	}
@@ -81,8 +133,11 @@ func (f *fetcher) optsToURL(opts FetchOptions) (string, error) {
 	if opts.Sort != "" {
 		q.Set("_sort", opts.Sort)
 	}
-	if len(opts.Tags) > 0 {
-		q.Set("tags-in", strings.Join(opts.Tags, ","))
+	if opts.NameID != "" {
+		q.Set("name_id", opts.NameID)
+	}
+	if !opts.DateUpdatedMin.IsZero() {
+		q.Set("date_updated-min", strconv.FormatInt(opts.DateUpdatedMin.Unix(), 10))
 	}
 	u.RawQuery = q.Encode()
 	return u.String(), nil
@@ -0,0 +1,39 @@
+package mods
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/metrics"
+)
+
+// RateLimiter limits the rate of requests made to the API by every Fetcher
+// it is shared with. It is a token bucket that refills at a steady rate and
+// allows short bursts of requests.
+type RateLimiter struct {
+	limiter *rate.Limiter
+}
+
+// NewRateLimiter creates a new RateLimiter that allows the given number of
+// requests per minute, with bursts of up to burst requests. If
+// requestsPerMinute is zero or less, requests are not limited.
+func NewRateLimiter(requestsPerMinute float64, burst int) *RateLimiter {
+	limit := rate.Inf
+	if requestsPerMinute > 0 {
+		limit = rate.Limit(requestsPerMinute / 60)
+	}
+	return &RateLimiter{limiter: rate.NewLimiter(limit, max(burst, 1))}
+}
+
+// Wait blocks until a request is allowed or the context is done. The time
+// spent waiting is recorded in metrics.
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	start := time.Now()
+	if err := r.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	metrics.RateLimitWait.Observe(time.Since(start).Seconds())
+	return nil
+}
@@ -0,0 +1,86 @@
+package mods
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// sortFields maps the JSON names of the sortable fields of a mod and its
+// stats to their index in the Mod struct.
+var sortFields = func() map[string][]int {
+	fields := make(map[string][]int)
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			path := append(append([]int(nil), index...), i)
+			switch field.Type.Kind() {
+			case reflect.Int, reflect.Uint64, reflect.Float64, reflect.String, reflect.Bool:
+				if _, ok := fields[name]; !ok && name != "" {
+					fields[name] = path
+				}
+			}
+		}
+	}
+	walk(reflect.TypeOf(Mod{}), nil)
+	if field, ok := reflect.TypeOf(Mod{}).FieldByName("Stats"); ok {
+		walk(field.Type, field.Index)
+	}
+	return fields
+}()
+
+// CanSort returns true if mods can be sorted by the given field. Fields are
+// the JSON names of the fields of a mod or its stats, optionally prefixed
+// with a "-" to sort in descending order.
+func CanSort(sort string) bool {
+	_, ok := sortFields[strings.TrimPrefix(sort, "-")]
+	return ok
+}
+
+// SortMods sorts the given mods in place by the given field (see CanSort).
+// Mods with equal values keep their relative order.
+func SortMods(modList []Mod, sort string) error {
+	name := strings.TrimPrefix(sort, "-")
+	index, ok := sortFields[name]
+	if !ok {
+		return fmt.Errorf("cannot sort mods by %q", name)
+	}
+	desc := strings.HasPrefix(sort, "-")
+	slices.SortStableFunc(modList, func(a, b Mod) int {
+		c := compareValues(
+			reflect.ValueOf(a).FieldByIndex(index),
+			reflect.ValueOf(b).FieldByIndex(index),
+		)
+		if desc {
+			return -c
+		}
+		return c
+	})
+	return nil
+}
+
+func compareValues(a, b reflect.Value) int {
+	switch a.Kind() {
+	case reflect.Int:
+		return cmp.Compare(a.Int(), b.Int())
+	case reflect.Uint64:
+		return cmp.Compare(a.Uint(), b.Uint())
+	case reflect.Float64:
+		return cmp.Compare(a.Float(), b.Float())
+	case reflect.String:
+		return strings.Compare(strings.ToLower(a.String()), strings.ToLower(b.String()))
+	case reflect.Bool:
+		if a.Bool() == b.Bool() {
+			return 0
+		}
+		if a.Bool() {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
@@ -1,6 +1,7 @@
 package mods
 
 import (
+	"strings"
 	"time"
 
 	"github.com/tinyzimmer/bg3mods-feed/internal/config"
@@ -14,6 +15,14 @@ type GetModsResponse struct {
 	ResultTotal  int   `json:"result_total"`
 }
 
+type GetModfilesResponse struct {
+	Data         []Modfile `json:"data"`
+	ResultCount  int       `json:"result_count"`
+	ResultLimit  int       `json:"result_limit"`
+	ResultOffset int       `json:"result_offset"`
+	ResultTotal  int       `json:"result_total"`
+}
+
 type Mod struct {
 	ID                   int           `json:"id"`
 	GameID               int           `json:"game_id"`
@@ -74,6 +83,27 @@ func (m Mod) SupportsPlatform(platform config.Platform) bool {
 	return false
 }
 
+func (m Mod) HasTag(name string) bool {
+	for _, t := range m.Tags {
+		if strings.EqualFold(t.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mentions returns true if the mod's name, summary or plaintext description
+// contains the given text, ignoring case.
+func (m Mod) Mentions(text string) bool {
+	text = strings.ToLower(text)
+	for _, field := range []string{m.Name, m.Summary, m.DescriptionPlaintext} {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
 	ID                int    `json:"id"`
 	NameID            string `json:"name_id"`
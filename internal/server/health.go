@@ -0,0 +1,60 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/feed"
+)
+
+// readiness is the response to a readiness check.
+type readiness struct {
+	// Ready is true if the catalog has been synced within the maximum sync age.
+	Ready bool `json:"ready"`
+	// Reason explains why the server is not ready.
+	Reason string `json:"reason,omitempty"`
+	// SyncAge is the time since the catalog was last synced.
+	SyncAge string `json:"sync_age,omitempty"`
+	feed.Status
+}
+
+// handleHealth reports that the server is up.
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady reports whether the catalog has been synced recently enough to
+// serve feeds, along with the state of the catalog and cached feeds.
+func handleReady(generator feed.Generator, maxSyncAge time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := readiness{Status: generator.Status()}
+		switch {
+		case res.SyncedAt.IsZero():
+			res.Reason = "the catalog has not been synced yet"
+		case maxSyncAge > 0 && time.Since(res.SyncedAt) > maxSyncAge:
+			res.SyncAge = time.Since(res.SyncedAt).Round(time.Second).String()
+			res.Reason = "the catalog has not been synced for over " + maxSyncAge.String()
+		default:
+			res.SyncAge = time.Since(res.SyncedAt).Round(time.Second).String()
+			res.Ready = true
+		}
+		status := http.StatusOK
+		if !res.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, r, status, res)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		slog.WarnContext(r.Context(), "Failed to write response", "error", err)
+	}
+}
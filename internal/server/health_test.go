@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/catalog"
+	"github.com/tinyzimmer/bg3mods-feed/internal/feed"
+)
+
+func TestReady(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		syncedAt   time.Time
+		wantStatus int
+		wantAge    bool
+	}{
+		{name: "never synced", wantStatus: http.StatusServiceUnavailable},
+		{name: "synced too long ago", syncedAt: time.Now().Add(-time.Hour), wantStatus: http.StatusServiceUnavailable, wantAge: true},
+		{name: "ready", syncedAt: time.Now().Add(-time.Minute), wantStatus: http.StatusOK, wantAge: true},
+	} {
+		srv := newTestServer(t, &fakeGenerator{status: feed.Status{
+			Status: catalog.Status{Mods: 10, SyncedAt: tc.syncedAt},
+			Feeds:  2,
+		}}, 15*time.Minute)
+		resp := get(t, srv.URL+"/readyz", nil)
+		if resp.StatusCode != tc.wantStatus {
+			t.Errorf("%s: GET /readyz status = %d, want %d", tc.name, resp.StatusCode, tc.wantStatus)
+		}
+		var res struct {
+			Ready   bool   `json:"ready"`
+			Reason  string `json:"reason"`
+			SyncAge string `json:"sync_age"`
+			Mods    int    `json:"mods"`
+			Feeds   int    `json:"feeds"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tc.name, err)
+		}
+		if ready := tc.wantStatus == http.StatusOK; res.Ready != ready || (res.Reason == "") != ready {
+			t.Errorf("%s: ready = %v with reason %q, want ready %v", tc.name, res.Ready, res.Reason, ready)
+		}
+		if (res.SyncAge != "") != tc.wantAge {
+			t.Errorf("%s: sync_age = %q, want it set %v", tc.name, res.SyncAge, tc.wantAge)
+		}
+		if res.Mods != 10 || res.Feeds != 2 {
+			t.Errorf("%s: mods = %d and feeds = %d, want the generator status", tc.name, res.Mods, res.Feeds)
+		}
+	}
+}
+
+func TestReadyWithoutMaxSyncAge(t *testing.T) {
+	srv := newTestServer(t, &fakeGenerator{status: feed.Status{
+		Status: catalog.Status{SyncedAt: time.Now().Add(-24 * time.Hour)},
+	}}, 0)
+	if resp := get(t, srv.URL+"/readyz", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /readyz status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
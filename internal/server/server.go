@@ -1,14 +1,30 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/tinyzimmer/bg3mods-feed/internal/config"
 	"github.com/tinyzimmer/bg3mods-feed/internal/feed"
+	"github.com/tinyzimmer/bg3mods-feed/internal/logging"
+	"github.com/tinyzimmer/bg3mods-feed/internal/metrics"
 )
 
 type Server struct {
@@ -17,36 +33,95 @@ type Server struct {
 
 type ServerOptions struct {
 	Generator feed.Generator
-	Addr      string
+	// Feeds are the named feeds served at /feeds/{name}.
+	Feeds map[string]feed.GeneratorOptions
+	// MaxSyncAge is the longest time since the catalog was last synced for
+	// the server to be reported ready. Zero means no limit.
+	MaxSyncAge time.Duration
+	Addr       string
 }
 
 func NewServer(opts ServerOptions) *Server {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /feed", func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		data, err := opts.Generator.GetFeed(r.Context(), feed.OptionsFromQuery(r.URL))
+		overrides, err := feed.OptionsFromQuery(r.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := opts.Generator.GetFeed(r.Context(), overrides)
 		if err != nil {
 			http.Error(w, "Failed to generate feed: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if data.Format == config.FormatJSON {
-			w.Header().Set("Content-Type", "application/json")
-		} else {
-			w.Header().Set("Content-Type", "application/xml")
+		writeFeed(w, r, data, start)
+	})
+	mux.HandleFunc("GET /feeds/{name}", func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		named, ok := opts.Feeds[r.PathValue("name")]
+		if !ok {
+			http.Error(w, "feed not found", http.StatusNotFound)
+			return
+		}
+		overrides, err := feed.OptionsFromQuery(r.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := opts.Generator.GetFeed(r.Context(), named.Merge(overrides))
+		if err != nil {
+			http.Error(w, "Failed to generate feed: "+err.Error(), http.StatusInternalServerError)
+			return
 		}
-		w.Header().Set("X-Feed-Generation-Time", time.Since(start).String())
-		fmt.Fprint(w, string(data.Content))
+		writeFeed(w, r, data, start)
 	})
+	mux.HandleFunc("GET /authors/{name_id}/feed", func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		overrides, err := feed.OptionsFromQuery(r.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		overrides.Author = r.PathValue("name_id")
+		data, err := opts.Generator.GetFeed(r.Context(), overrides)
+		if err != nil {
+			http.Error(w, "Failed to generate feed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeFeed(w, r, data, start)
+	})
+	mux.HandleFunc("GET /mods/{name_id}/feed", func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		overrides, err := feed.OptionsFromQuery(r.URL)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := opts.Generator.GetModFeed(r.Context(), r.PathValue("name_id"), overrides)
+		if err != nil {
+			if errors.Is(err, feed.ErrModNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to generate feed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeFeed(w, r, data, start)
+	})
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.HandleFunc("GET /healthz", handleHealth)
+	mux.HandleFunc("GET /readyz", handleReady(opts.Generator, opts.MaxSyncAge))
 	return &Server{
 		srv: &http.Server{
 			Addr:    opts.Addr,
-			Handler: logRequests(mux),
+			Handler: traceRequests(logRequests(instrumentRequests(mux))),
 		},
 	}
 }
 
 func (s *Server) ListenAndServe() error {
-	log.Println("Listening on", s.srv.Addr)
+	slog.Info("Listening", "addr", s.srv.Addr)
 	if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		return err
 	}
@@ -57,10 +132,132 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.srv.Shutdown(ctx)
 }
 
+// writeFeed writes a feed to the response. The feed is only written if it
+// has changed since the version the client has cached, according to the
+// If-None-Match and If-Modified-Since headers of the request.
+func writeFeed(w http.ResponseWriter, r *http.Request, data *feed.Feed, start time.Time) {
+	if data.Format == config.FormatJSON {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/xml")
+	}
+	w.Header().Set("X-Feed-Generation-Time", time.Since(start).String())
+	if data.Stale {
+		w.Header().Set("X-Feed-Stale", "true")
+	}
+	sum := sha256.Sum256(data.Content)
+	w.Header().Set("ETag", `"`+base64.RawURLEncoding.EncodeToString(sum[:16])+`"`)
+	maxAge := max(time.Until(data.ExpiresAt), 0)
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	http.ServeContent(w, r, "", data.SyncedAt, bytes.NewReader(data.Content))
+}
+
+// logRequests logs every request once it has been served. Each request is
+// assigned an ID, which is taken from the X-Request-ID header if the client
+// sent a valid one, returned in the same header and logged with everything
+// logged while serving the request.
 func logRequests(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		h.ServeHTTP(w, r)
-		log.Println(r.Method, r.URL.String(), "-", time.Since(start).String())
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		r = r.WithContext(logging.WithRequestID(r.Context(), id))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		slog.InfoContext(r.Context(), "Served request",
+			"method", r.Method,
+			"url", r.URL.String(),
+			"status", rec.status,
+			"duration", time.Since(start),
+		)
+	})
+}
+
+// validRequestID reports whether a request ID sent by a client is short and
+// printable enough to be logged and echoed back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	// readRandom reads the random bytes of request IDs.
+	readRandom = rand.Read
+	// requestCounter numbers the requests that were assigned an ID without
+	// random bytes.
+	requestCounter atomic.Uint64
+)
+
+// newRequestID returns a random request ID. If no random bytes can be read,
+// an ID unique to this process is made from the time and a counter instead.
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := readRandom(b); err != nil {
+		return fmt.Sprintf("%x-%d", time.Now().UnixNano(), requestCounter.Add(1))
+	}
+	return hex.EncodeToString(b)
+}
+
+// traceRequests traces requests for feeds, continuing any trace started by
+// the client according to the W3C trace context headers of the request.
+func traceRequests(h http.Handler) http.Handler {
+	return otelhttp.NewHandler(h, "http.server",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			switch r.URL.Path {
+			case "/metrics", "/healthz", "/readyz":
+				return false
+			}
+			return true
+		}),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+	)
+}
+
+// statusRecorder records the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// instrumentRequests records the count and duration of requests in metrics,
+// by the route that served them and the requested feed format.
+func instrumentRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		if method, path, ok := strings.Cut(r.Pattern, " "); ok {
+			// The route is only known once the request has been routed
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(method + " " + path)
+			span.SetAttributes(attribute.String("http.route", path))
+		}
+		format := "default"
+		if f := config.FeedFormat(r.URL.Query().Get("format")); f.IsValid() {
+			format = string(f)
+		}
+		metrics.Requests.WithLabelValues(route, format, strconv.Itoa(rec.status)).Inc()
+		metrics.RequestDuration.WithLabelValues(route, format).Observe(time.Since(start).Seconds())
 	})
 }
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/catalog"
+	"github.com/tinyzimmer/bg3mods-feed/internal/config"
+	"github.com/tinyzimmer/bg3mods-feed/internal/feed"
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+	"github.com/tinyzimmer/bg3mods-feed/internal/store"
+	"github.com/tinyzimmer/bg3mods-feed/internal/tracing"
+)
+
+// otlpReceiver is an OTLP/HTTP collector that records the trace ID of every
+// span it receives by name.
+type otlpReceiver struct {
+	mu     sync.Mutex
+	traces map[string][]string
+}
+
+func (o *otlpReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, resourceSpans := range req.GetResourceSpans() {
+		for _, scopeSpans := range resourceSpans.GetScopeSpans() {
+			for _, span := range scopeSpans.GetSpans() {
+				o.traces[span.GetName()] = append(o.traces[span.GetName()], hex.EncodeToString(span.GetTraceId()))
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+// TestTracing requests a feed with a trace context, and checks the spans of
+// the request and the trace context sent upstream are part of its trace.
+func TestTracing(t *testing.T) {
+	receiver := &otlpReceiver{traces: make(map[string][]string)}
+	collector := httptest.NewServer(receiver)
+	defer collector.Close()
+
+	var mu sync.Mutex
+	var traceparents []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		mu.Unlock()
+		json.NewEncoder(w).Encode(mods.GetModsResponse{
+			Data: []mods.Mod{{ID: 1, NameID: "one", Name: "One", DateUpdatedEpoch: uint64(time.Now().Unix())}},
+		})
+	}))
+	defer upstream.Close()
+
+	shutdown, err := tracing.Setup(context.Background(), collector.URL, "test")
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	fetcher := mods.NewFetcher(upstream.URL, mods.WithMaxRetries(0))
+	modStore := store.NewMemoryStore()
+	generator := feed.NewGenerator(catalog.New(fetcher, modStore, time.Hour), fetcher, modStore, feed.GeneratorOptions{
+		MaxItems:      10,
+		Sort:          config.DefaultSort,
+		FetchInterval: time.Minute,
+		Format:        config.FormatRSS,
+		Mode:          config.ModeMods,
+	})
+	s := NewServer(ServerOptions{Generator: generator})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/feed", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /feed status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	for _, name := range []string{"GET /feed", "feed.GetFeed", "mods.Fetch"} {
+		ids := receiver.traces[name]
+		if len(ids) == 0 {
+			t.Errorf("no %q span was exported", name)
+		}
+		for _, id := range ids {
+			if id != traceID {
+				t.Errorf("%q span trace ID = %s, want %s", name, id, traceID)
+			}
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(traceparents) == 0 {
+		t.Fatal("no requests were sent upstream")
+	}
+	for _, traceparent := range traceparents {
+		if len(traceparent) != 55 || traceparent[3:35] != traceID {
+			t.Errorf("upstream traceparent = %q, want trace ID %s", traceparent, traceID)
+		}
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	for _, random := range []bool{true, false} {
+		if !random {
+			readRandom = func([]byte) (int, error) { return 0, errors.New("no entropy") }
+			t.Cleanup(func() { readRandom = rand.Read })
+		}
+		seen := make(map[string]bool)
+		for range 100 {
+			id := newRequestID()
+			if !validRequestID(id) {
+				t.Errorf("newRequestID() = %q, which is not a valid request ID", id)
+			}
+			if seen[id] {
+				t.Errorf("newRequestID() returned %q twice", id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+// fakeGenerator serves the same feed for every request.
+type fakeGenerator struct {
+	feed   *feed.Feed
+	status feed.Status
+}
+
+func (g *fakeGenerator) GetFeed(context.Context, feed.GeneratorOptions) (*feed.Feed, error) {
+	return g.feed, nil
+}
+
+func (g *fakeGenerator) GetModFeed(context.Context, string, feed.GeneratorOptions) (*feed.Feed, error) {
+	return g.feed, nil
+}
+
+func (g *fakeGenerator) Watch(context.Context, feed.GeneratorOptions) {}
+
+func (g *fakeGenerator) Run(context.Context) {}
+
+func (g *fakeGenerator) Status() feed.Status { return g.status }
+
+func newTestServer(t *testing.T, generator feed.Generator, maxSyncAge time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(NewServer(ServerOptions{Generator: generator, MaxSyncAge: maxSyncAge}).srv.Handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, url string, headers map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestWriteFeedConditional(t *testing.T) {
+	syncedAt := time.Now().UTC().Truncate(time.Second).Add(-time.Minute)
+	content := []byte(`<?xml version="1.0" encoding="UTF-8"?><feed></feed>`)
+	generator := &fakeGenerator{feed: &feed.Feed{
+		Content:   content,
+		Format:    config.FormatAtom,
+		SyncedAt:  syncedAt,
+		ExpiresAt: syncedAt.Add(5 * time.Minute),
+	}}
+	srv := newTestServer(t, generator, 0)
+
+	resp := get(t, srv.URL+"/feed", nil)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != string(content) {
+		t.Fatalf("GET /feed = %d %q, want 200 with the feed", resp.StatusCode, body)
+	}
+	sum := sha256.Sum256(content)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	if got := resp.Header.Get("ETag"); got != etag {
+		t.Errorf("ETag = %s, want %s", got, etag)
+	}
+	// The feed expires in four minutes, less the time taken to serve it
+	var maxAge int
+	if _, err := fmt.Sscanf(resp.Header.Get("Cache-Control"), "max-age=%d", &maxAge); err != nil || maxAge < 230 || maxAge > 240 {
+		t.Errorf("Cache-Control = %q, want max-age=240", resp.Header.Get("Cache-Control"))
+	}
+	if got := resp.Header.Get("Last-Modified"); got != syncedAt.Format(http.TimeFormat) {
+		t.Errorf("Last-Modified = %q, want %q", got, syncedAt.Format(http.TimeFormat))
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/xml" {
+		t.Errorf("Content-Type = %q, want application/xml", got)
+	}
+	if got := resp.Header.Get("X-Feed-Stale"); got != "" {
+		t.Errorf("X-Feed-Stale = %q for a fresh feed", got)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{name: "matching ETag", headers: map[string]string{"If-None-Match": etag}, want: http.StatusNotModified},
+		{name: "other ETag", headers: map[string]string{"If-None-Match": `"other"`}, want: http.StatusOK},
+		{name: "not modified since", headers: map[string]string{"If-Modified-Since": syncedAt.Format(http.TimeFormat)}, want: http.StatusNotModified},
+		{name: "modified since", headers: map[string]string{"If-Modified-Since": syncedAt.Add(-time.Hour).Format(http.TimeFormat)}, want: http.StatusOK},
+	} {
+		resp := get(t, srv.URL+"/feed", tc.headers)
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: GET /feed status = %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+		if tc.want == http.StatusNotModified && len(body) > 0 {
+			t.Errorf("%s: GET /feed returned a body with a 304", tc.name)
+		}
+	}
+}
+
+func TestWriteFeedStale(t *testing.T) {
+	syncedAt := time.Now().UTC().Add(-time.Hour)
+	srv := newTestServer(t, &fakeGenerator{feed: &feed.Feed{
+		Content:   []byte(`{"version": "https://jsonfeed.org/version/1.1"}`),
+		Format:    config.FormatJSON,
+		SyncedAt:  syncedAt,
+		ExpiresAt: syncedAt.Add(5 * time.Minute),
+		Stale:     true,
+	}}, 0)
+	resp := get(t, srv.URL+"/feed", nil)
+	if got := resp.Header.Get("X-Feed-Stale"); got != "true" {
+		t.Errorf("X-Feed-Stale = %q, want true", got)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != "max-age=0" {
+		t.Errorf("Cache-Control = %q, want max-age=0", got)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+)
+
+var (
+	modsBucket      = []byte("mods")
+	snapshotsBucket = []byte("snapshots")
+)
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore creates a new Store backed by a BoltDB file at the given path.
+// The file and its parent directory are created if they do not exist.
+func NewBoltStore(path string) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{modsBucket, snapshotsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize store: %w", err)
+	}
+	return &boltStore{db}, nil
+}
+
+func (s *boltStore) PutMods(ctx context.Context, mods []mods.Mod, fetchedAt time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(modsBucket)
+		for _, mod := range mods {
+			key := modKey(mod.ID)
+			var existing *ModRecord
+			if data := b.Get(key); data != nil {
+				existing = &ModRecord{}
+				if err := json.Unmarshal(data, existing); err != nil {
+					return fmt.Errorf("failed to decode mod %d: %w", mod.ID, err)
+				}
+			}
+			data, err := json.Marshal(mergeRecord(existing, mod, fetchedAt))
+			if err != nil {
+				return fmt.Errorf("failed to encode mod %d: %w", mod.ID, err)
+			}
+			if err := b.Put(key, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) PutModfiles(ctx context.Context, modID int, modfiles []mods.Modfile, fetchedAt time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(modsBucket)
+		key := modKey(modID)
+		data := b.Get(key)
+		if data == nil {
+			return ErrNotFound
+		}
+		var record ModRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return fmt.Errorf("failed to decode mod %d: %w", modID, err)
+		}
+		mergeModfiles(&record, modfiles, fetchedAt)
+		data, err := json.Marshal(&record)
+		if err != nil {
+			return fmt.Errorf("failed to encode mod %d: %w", modID, err)
+		}
+		return b.Put(key, data)
+	})
+}
+
+func (s *boltStore) GetMods(ctx context.Context, ids []int) ([]*ModRecord, error) {
+	records := make([]*ModRecord, 0, len(ids))
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(modsBucket)
+		for _, id := range ids {
+			data := b.Get(modKey(id))
+			if data == nil {
+				continue
+			}
+			var record ModRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return fmt.Errorf("failed to decode mod %d: %w", id, err)
+			}
+			records = append(records, &record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (s *boltStore) PutSnapshot(ctx context.Context, key string, snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(snapshotsBucket).Put([]byte(key), data)
+	})
+}
+
+func (s *boltStore) GetSnapshot(ctx context.Context, key string) (*Snapshot, error) {
+	var snapshot Snapshot
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(snapshotsBucket).Get([]byte(key))
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, &snapshot)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+func modKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
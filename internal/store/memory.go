@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+)
+
+type memoryStore struct {
+	mods      map[int]*ModRecord
+	snapshots map[string]*Snapshot
+	mu        sync.RWMutex
+}
+
+// NewMemoryStore creates a new Store that only keeps records in memory.
+// Records are lost when the process exits.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		mods:      make(map[int]*ModRecord),
+		snapshots: make(map[string]*Snapshot),
+	}
+}
+
+func (s *memoryStore) PutMods(ctx context.Context, mods []mods.Mod, fetchedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, mod := range mods {
+		s.mods[mod.ID] = mergeRecord(s.mods[mod.ID], mod, fetchedAt)
+	}
+	return nil
+}
+
+func (s *memoryStore) PutModfiles(ctx context.Context, modID int, modfiles []mods.Modfile, fetchedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.mods[modID]
+	if !ok {
+		return ErrNotFound
+	}
+	mergeModfiles(record, modfiles, fetchedAt)
+	return nil
+}
+
+func (s *memoryStore) GetMods(ctx context.Context, ids []int) ([]*ModRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]*ModRecord, 0, len(ids))
+	for _, id := range ids {
+		if record, ok := s.mods[id]; ok {
+			copied := *record
+			copied.Modfiles = append([]ModfileRecord(nil), record.Modfiles...)
+			records = append(records, &copied)
+		}
+	}
+	return records, nil
+}
+
+func (s *memoryStore) PutSnapshot(ctx context.Context, key string, snapshot *Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[key] = snapshot
+	return nil
+}
+
+func (s *memoryStore) GetSnapshot(ctx context.Context, key string) (*Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot, ok := s.snapshots[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return snapshot, nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
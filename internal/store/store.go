@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
+)
+
+// ErrNotFound is returned when a requested record does not exist in the store.
+var ErrNotFound = errors.New("not found")
+
+// Store is an interface for persisting mods seen by the fetcher.
+type Store interface {
+	// PutMods records the given mods as fetched at the given time.
+	PutMods(ctx context.Context, mods []mods.Mod, fetchedAt time.Time) error
+	// PutModfiles records the given modfiles as releases of a previously
+	// recorded mod. ErrNotFound is returned if the mod has not been recorded.
+	PutModfiles(ctx context.Context, modID int, modfiles []mods.Modfile, fetchedAt time.Time) error
+	// GetMods returns the records for the mods with the given IDs in the
+	// same order. IDs that have never been recorded are skipped.
+	GetMods(ctx context.Context, ids []int) ([]*ModRecord, error)
+	// PutSnapshot records a list of mods under the given key.
+	PutSnapshot(ctx context.Context, key string, snapshot *Snapshot) error
+	// GetSnapshot returns the last snapshot recorded under the given key.
+	// ErrNotFound is returned if there is none.
+	GetSnapshot(ctx context.Context, key string) (*Snapshot, error)
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// ModRecord is a mod as it was last seen by the fetcher.
+type ModRecord struct {
+	// Mod is the most recently fetched copy of the mod.
+	Mod mods.Mod `json:"mod"`
+	// FirstSeen is the time the mod was first fetched.
+	FirstSeen time.Time `json:"first_seen"`
+	// LastSeen is the time the mod was last fetched.
+	LastSeen time.Time `json:"last_seen"`
+	// Modfiles is every distinct modfile seen for the mod, oldest first.
+	Modfiles []ModfileRecord `json:"modfiles"`
+}
+
+// ModfileRecord is a modfile (release) of a mod as it was first seen by the fetcher.
+type ModfileRecord struct {
+	// Modfile is the modfile as it was first fetched.
+	Modfile mods.Modfile `json:"modfile"`
+	// SeenAt is the time the modfile was first fetched.
+	SeenAt time.Time `json:"seen_at"`
+}
+
+// Snapshot is a list of mods, such as the catalog, at a point in time.
+type Snapshot struct {
+	// ModIDs are the IDs of the mods, in order.
+	ModIDs []int `json:"mod_ids"`
+	// SyncedAt is the time the mods were synced.
+	SyncedAt time.Time `json:"synced_at"`
+	// FullSyncedAt is the time the mods were last synced in full, for
+	// lists that are otherwise synced incrementally.
+	FullSyncedAt time.Time `json:"full_synced_at"`
+}
+
+// New returns a Store persisted to the file at the given path. If the path
+// is empty, an in-memory store is returned instead.
+func New(path string) (Store, error) {
+	if path == "" {
+		return NewMemoryStore(), nil
+	}
+	return NewBoltStore(path)
+}
+
+func mergeRecord(existing *ModRecord, mod mods.Mod, fetchedAt time.Time) *ModRecord {
+	if existing == nil {
+		existing = &ModRecord{FirstSeen: fetchedAt}
+	}
+	existing.Mod = mod
+	if fetchedAt.After(existing.LastSeen) {
+		existing.LastSeen = fetchedAt
+	}
+	if mod.Modfile.ID != 0 && !existing.HasModfile(mod.Modfile) {
+		existing.Modfiles = append(existing.Modfiles, ModfileRecord{
+			Modfile: mod.Modfile,
+			SeenAt:  fetchedAt,
+		})
+	}
+	return existing
+}
+
+func mergeModfiles(existing *ModRecord, modfiles []mods.Modfile, fetchedAt time.Time) {
+	for _, modfile := range modfiles {
+		if modfile.ID != 0 && !existing.HasModfile(modfile) {
+			existing.Modfiles = append(existing.Modfiles, ModfileRecord{
+				Modfile: modfile,
+				SeenAt:  fetchedAt,
+			})
+		}
+	}
+	sort.SliceStable(existing.Modfiles, func(i, j int) bool {
+		return existing.Modfiles[i].Modfile.DateAdded < existing.Modfiles[j].Modfile.DateAdded
+	})
+}
+
+// HasModfile returns true if the given modfile has already been recorded
+// with the same ID and version.
+func (r *ModRecord) HasModfile(modfile mods.Modfile) bool {
+	for _, seen := range r.Modfiles {
+		if seen.Modfile.ID == modfile.ID && seen.Modfile.Version == modfile.Version {
+			return true
+		}
+	}
+	return false
+}
@@ -4,17 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/spf13/pflag"
 
+	"github.com/tinyzimmer/bg3mods-feed/internal/catalog"
 	"github.com/tinyzimmer/bg3mods-feed/internal/config"
 	"github.com/tinyzimmer/bg3mods-feed/internal/feed"
+	"github.com/tinyzimmer/bg3mods-feed/internal/logging"
 	"github.com/tinyzimmer/bg3mods-feed/internal/mods"
 	"github.com/tinyzimmer/bg3mods-feed/internal/server"
+	"github.com/tinyzimmer/bg3mods-feed/internal/store"
+	"github.com/tinyzimmer/bg3mods-feed/internal/tracing"
 )
 
 var (
@@ -33,7 +37,7 @@ func main() {
 		if errors.Is(err, pflag.ErrHelp) {
 			os.Exit(0)
 		}
-		log.Fatal("Failed to parse flags:", err)
+		fatal("Failed to parse flags", err)
 	}
 
 	if *version {
@@ -44,32 +48,63 @@ func main() {
 
 	conf, err := config.Load(*configFile)
 	if err != nil {
-		log.Fatal("Failed to load configuration:", err)
+		fatal("Failed to load configuration", err)
+	}
+	slog.SetDefault(logging.New(os.Stderr, conf.LogLevel, conf.LogFormat == config.LogFormatJSON))
+	if err := checkSorts(conf); err != nil {
+		fatal("Invalid configuration", err)
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), conf.OTLPEndpoint, Version)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+	modStore, err := store.New(conf.StorePath)
+	if err != nil {
+		fatal("Failed to open store", err)
+	}
+	defer modStore.Close()
+	fetcher := mods.NewFetcher(conf.APIURL,
+		mods.WithAPIKey(conf.APIKey),
+		mods.WithAccessToken(conf.AccessToken),
+		mods.WithTimeout(conf.HTTPTimeout),
+		mods.WithMaxRetries(conf.MaxRetries),
+		mods.WithBackoff(conf.RetryBackoff, conf.MaxRetryBackoff),
+		mods.WithPageCache(conf.PageCacheSize, int(conf.PageCacheMaxSize)),
+		mods.WithRateLimiter(mods.NewRateLimiter(conf.RequestsPerMinute, conf.RequestBurst)),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	modCatalog := catalog.New(fetcher, modStore, conf.FullSyncInterval)
+	if err := modCatalog.Load(ctx); err != nil {
+		slog.Warn("Failed to load catalog", "error", err)
+	}
+	defaults := feed.OptionsFromConfig(conf.FeedConfig)
+	defaults.FetchInterval = conf.FetchInterval
+	generator := feed.NewGenerator(modCatalog, fetcher, modStore, defaults)
+	generator.Watch(ctx, feed.GeneratorOptions{})
+	namedFeeds := make(map[string]feed.GeneratorOptions, len(conf.Feeds))
+	for _, namedFeed := range conf.Feeds {
+		opts := feed.OptionsFromConfig(namedFeed.FeedConfig)
+		opts.Title = namedFeed.Title
+		opts.Description = namedFeed.Description
+		namedFeeds[namedFeed.Name] = opts
+		generator.Watch(ctx, opts)
 	}
-	fetcher := mods.NewFetcher(conf.APIURL)
-	generator := feed.NewGenerator(fetcher, feed.GeneratorOptions{
-		MaxItems:      conf.MaxFeedItems,
-		Sort:          conf.Sort,
-		Tags:          conf.Tags,
-		Platform:      conf.Platform,
-		FetchInterval: conf.FetchInterval,
-		Format:        conf.Format,
-	})
 
 	server := server.NewServer(server.ServerOptions{
-		Generator: generator,
-		Addr:      conf.Listen,
+		Generator:  generator,
+		Feeds:      namedFeeds,
+		MaxSyncAge: conf.MaxSyncAge,
+		Addr:       conf.Listen,
 	})
 
-	log.Println("Starting BG3 Mods Feed server")
-	log.Println("    Version:", Version)
-	log.Println("    Commit:", Commit)
-	log.Println("    Build Date:", Date)
+	slog.Info("Starting BG3 Mods Feed server", "version", Version, "commit", Commit, "build_date", Date)
 	conf.Log()
 
+	go generator.Run(ctx)
 	go func() {
 		if err := server.ListenAndServe(); err != nil {
-			log.Fatal("Failed to start server:", err)
+			fatal("Failed to start server", err)
 		}
 	}()
 
@@ -77,9 +112,35 @@ func main() {
 	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
 	<-sigc
 
-	log.Println("Shutting down server...")
-	ctx := context.Background()
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatal("Failed to shutdown server:", err)
+	slog.Info("Shutting down server")
+	cancel()
+	if err := server.Shutdown(context.Background()); err != nil {
+		fatal("Failed to shutdown server", err)
 	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
+	}
+}
+
+// fatal logs an error and exits.
+// checkSorts checks that the default feed and every named feed are sorted by
+// a field mods can be sorted by. The config package cannot check this itself,
+// as the sortable fields are defined in the mods package.
+func checkSorts(conf config.Configuration) error {
+	defaults := feed.OptionsFromConfig(conf.FeedConfig)
+	if !mods.CanSort(defaults.GetSort()) {
+		return fmt.Errorf("invalid sort %q", conf.Sort)
+	}
+	for _, namedFeed := range conf.Feeds {
+		opts := defaults.Merge(feed.OptionsFromConfig(namedFeed.FeedConfig))
+		if !mods.CanSort(opts.GetSort()) {
+			return fmt.Errorf("invalid sort %q for feed %q", opts.Sort, namedFeed.Name)
+		}
+	}
+	return nil
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }